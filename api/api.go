@@ -3,105 +3,339 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"strings"
+	"time"
+	"url-shortener/canonical"
+	"url-shortener/config"
 	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/monitoring"
 	"url-shortener/utils"
 )
 
+// auditLog records the urls rejected by the target policies, apart from the
+// other logs
+var auditLog = log.New(os.Stderr, "AUDIT ", log.LstdFlags|log.LUTC|log.Lmsgprefix)
+
+// collapsedSchemePattern matches a scheme followed by a single slash
+var collapsedSchemePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*:/)([^/]|$)`)
+
+// maxShortenAttempts is the number of short urls tried before giving up on collisions
+const maxShortenAttempts = 5
+
 type API struct {
-	ctx context.Context
-	db  interfaces.Store
+	ctx   context.Context
+	db    interfaces.Store
+	codes interfaces.CodeGenerator
+	// canon rewrites the urls before they are deduplicated, nil when disabled
+	canon *canonical.Canonicalizer
+	// schemes are the lowercased schemes of the urls which can be shortened
+	schemes      map[string]bool
+	maxURLLength int
+	// targets checks the urls before they are shortened and redirects the
+	// targets of the links before they are redirected to, nil allows every url
+	targets   interfaces.TargetPolicy
+	redirects interfaces.TargetPolicy
 }
 
-func NewAPI(ctx context.Context, db interfaces.Store) interfaces.API {
+func NewAPI(ctx context.Context, db interfaces.Store, codes interfaces.CodeGenerator, cfg config.API, targets, redirects interfaces.TargetPolicy) interfaces.API {
 	a := &API{
-		ctx: ctx,
-		db:  db,
+		ctx:          ctx,
+		db:           db,
+		codes:        codes,
+		schemes:      make(map[string]bool),
+		maxURLLength: cfg.MaxURLLength,
+		targets:      targets,
+		redirects:    redirects,
+	}
+	// The zero value of the settings falls back to the defaults
+	if a.maxURLLength <= 0 {
+		a.maxURLLength = maxURLLength
+	}
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	for _, scheme := range schemes {
+		a.schemes[strings.ToLower(scheme)] = true
+	}
+	if cfg.Canonicalize {
+		a.canon = canonical.New(canonical.Options{SortQuery: cfg.SortQueryParams, StripParams: cfg.StripQueryParams})
 	}
 	return a
 }
 
+// errorStatus maps an error returned by the store to the matching HTTP status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, interfaces.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, interfaces.ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, interfaces.ErrBlocked):
+		return http.StatusUnavailableForLegalReasons
+	case errors.Is(err, interfaces.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// audit records the url rejected by a target policy
+func audit(r *http.Request, operation, target string, err error) {
+	monitoring.TargetsRejected.WithLabelValues(operation).Inc()
+	auditLog.Printf("operation=%v status=%d client=%v url=%q reason=%q", operation, errorStatus(err), r.RemoteAddr, target, err)
+}
+
+// writeJSON writes the value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonResponse, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
 // RedirectURL redirects the shortened url to the original url
 func (a *API) RedirectURL(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Redirect URL", r.URL.String())
 	shortKey := r.URL.Path[len("/redirect/"):]
 	if shortKey == "" {
 		http.Error(w, "Short key is missing", http.StatusNotFound)
 		return
 	}
 
-	url := a.db.GetByShortURL(shortKey)
-	if url == "" {
-		http.Error(w, "Shorten URL not found", http.StatusNotFound)
+	link, err := a.db.GetByShortURL(r.Context(), shortKey)
+	if err != nil {
+		status := errorStatus(err)
+		if status == http.StatusNotFound {
+			monitoring.Redirects.WithLabelValues("miss").Inc()
+			http.Error(w, "Shorten URL not found", status)
+			return
+		}
+		monitoring.Redirects.WithLabelValues("error").Inc()
+		log.Printf("Failed to resolve %v. %v", shortKey, err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if link.Expired(time.Now()) {
+		monitoring.Redirects.WithLabelValues("expired").Inc()
+		http.Error(w, "Shorten URL has expired", http.StatusGone)
 		return
 	}
+	// The target is checked on every redirect, so that links to targets
+	// blocked after they were shortened stop working
+	if err := checkTarget(r.Context(), a.redirects, link.Target()); err != nil {
+		status := errorStatus(err)
+		if errors.Is(err, interfaces.ErrForbidden) {
+			monitoring.Redirects.WithLabelValues("blocked").Inc()
+			audit(r, "redirect", link.Target(), err)
+			http.Error(w, "Shorten URL is blocked", status)
+			return
+		}
+		monitoring.Redirects.WithLabelValues("error").Inc()
+		log.Printf("Failed to check the target of %v. %v", shortKey, err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	monitoring.Redirects.WithLabelValues("hit").Inc()
+
+	// A failure to record the click must not break the redirect
+	click := &models.ClickCollection{
+		ShortURL:  shortKey,
+		Timestamp: time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+	if err := a.db.RecordClick(r.Context(), click); err != nil {
+		log.Printf("Failed to record the click on %v. %v", shortKey, err)
+	}
 
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
+	http.Redirect(w, r, link.Target(), http.StatusMovedPermanently)
 }
 
 // URLShortner returns a shorten url of the original url
 func (a *API) UrlShortner(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		jsonResponse, _ := json.Marshal(map[string]string{"Error": "Method not Supported!"})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(jsonResponse)
-
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"Error": "Method not Supported!"})
 		return
 	}
 
 	url := r.URL.String()
-	finalUrl := strings.Split(url, "/short/")[1]
+	finalUrl := strings.SplitN(url, "/short/", 2)[1]
 	if finalUrl == "" {
-		jsonResponse, _ := json.Marshal(map[string]string{"Error": "URL is Empty!"})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": "URL is Empty!"})
+		return
+	}
 
+	// Clients and proxies may clean the path, which turns the "//" after the
+	// scheme into "/"
+	finalUrl = collapsedSchemePattern.ReplaceAllString(finalUrl, "$1/$2")
+	finalUrl, err := a.validateURL(finalUrl)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
 		return
 	}
 
-	if !strings.Contains(finalUrl, "https://") {
-		finalUrl = "https://" + finalUrl
+	link, _, err := a.shorten(r.Context(), &models.UrlCollection{URL: finalUrl})
+	if err != nil {
+		if errors.Is(err, interfaces.ErrForbidden) {
+			audit(r, "create", finalUrl, err)
+		}
+		writeJSON(w, errorStatus(err), map[string]string{"Error": shortenError(err)})
+		return
 	}
-	shortUrl := utils.ShortenURL(finalUrl)
 
-	existingURL := a.db.GetByURL(finalUrl)
-	if existingURL != "" {
-		jsonResponse, _ := json.Marshal(map[string]string{"short_url": existingURL})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		w.Write(jsonResponse)
+	writeJSON(w, http.StatusCreated, map[string]string{"short_url": link.ShortURL})
+}
 
-		return
+// shorten stores the link and reports whether it was created. When the url
+// has already been shortened the existing entry is returned instead, unless the
+// link asks for a different short url or the existing entry has expired.
+// Generated short urls which collide with an existing one are retried with the
+// next attempt of the generator.
+func (a *API) shorten(ctx context.Context, link *models.UrlCollection) (*models.UrlCollection, bool, error) {
+	if err := checkTarget(ctx, a.targets, link.URL); err != nil {
+		return nil, false, err
+	}
+	if err := a.canonicalize(link); err != nil {
+		return nil, false, err
 	}
 
-	created := a.db.Create(finalUrl, shortUrl)
-	if !created {
-		jsonResponse, _ := json.Marshal(map[string]string{"Error": "Failed to Shorten the URl!"})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(jsonResponse)
+	alias := link.ShortURL != ""
+	existing, err := a.db.GetByURL(ctx, link.URL)
+	if err == nil && !existing.Expired(time.Now()) {
+		return reuse(existing, link, alias)
+	}
+	if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+		log.Printf("Failed to look up %v. %v", link.URL, err)
+		return nil, false, err
+	}
 
-		return
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
 	}
 
-	jsonResponse, _ := json.Marshal(map[string]string{"short_url": shortUrl})
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	w.Write(jsonResponse)
+	for attempt := 0; ; attempt++ {
+		if !alias {
+			code, err := a.codes.Generate(link.URL, attempt)
+			if err != nil {
+				log.Printf("Failed to generate a short url for %v. %v", link.URL, err)
+				return nil, false, err
+			}
+			link.ShortURL = utils.GetDomain(link.URL) + "/" + code
+		}
 
-	return
+		err = a.db.Create(ctx, link)
+		switch {
+		case err == nil:
+			monitoring.LinksCreated.Inc()
+			return link, true, nil
+		case errors.Is(err, interfaces.ErrShortURLConflict):
+			if alias {
+				return nil, false, err
+			}
+			if attempt+1 == maxShortenAttempts {
+				log.Printf("Failed to create %v. %v", link.URL, err)
+				return nil, false, fmt.Errorf("no unique short url after %d attempts: %v", maxShortenAttempts, err)
+			}
+			log.Printf("Short url %v collided, retrying. %v", link.ShortURL, err)
+		case errors.Is(err, interfaces.ErrConflict):
+			// The url was shortened by a concurrent request, return the entry which won
+			existing, getErr := a.db.GetByURL(ctx, link.URL)
+			if getErr != nil {
+				return nil, false, err
+			}
+			return reuse(existing, link, alias)
+		default:
+			log.Printf("Failed to create %v. %v", link.URL, err)
+			return nil, false, err
+		}
+	}
 }
 
-// Metrics returns the top three domains
+// checkTarget returns the error of the policy when it does not allow the url.
+// The url of a new link is checked before the existing links are looked up,
+// so that links created before the policy was changed are not handed out.
+func checkTarget(ctx context.Context, policy interfaces.TargetPolicy, rawURL string) error {
+	if policy == nil {
+		return nil
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+	}
+	if err := policy.Check(ctx, target); err != nil {
+		log.Printf("Rejected %v. %v", rawURL, err)
+		return err
+	}
+	return nil
+}
+
+// shortenError returns the message of a failure to shorten a url, the reason
+// is only given when the url itself is at fault or is already shortened
+func shortenError(err error) string {
+	if errors.Is(err, interfaces.ErrForbidden) || errors.Is(err, interfaces.ErrInvalidArgument) ||
+		errors.Is(err, interfaces.ErrConflict) {
+		return err.Error()
+	}
+	return "Failed to Shorten the URl!"
+}
+
+// canonicalize replaces the url of the link by its canonical form and keeps
+// the url as given for the redirect
+func (a *API) canonicalize(link *models.UrlCollection) error {
+	if a.canon == nil {
+		return nil
+	}
+	canonical, err := a.canon.Canonicalize(link.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+	}
+	if canonical != link.URL {
+		link.OriginalURL = link.URL
+		link.URL = canonical
+	}
+	return nil
+}
+
+// reuse returns the existing entry of a url unless the link asks for another
+// short url with an alias. A generated short url is never kept over the
+// existing one.
+func reuse(existing, link *models.UrlCollection, alias bool) (*models.UrlCollection, bool, error) {
+	if alias && link.ShortURL != existing.ShortURL {
+		return nil, false, fmt.Errorf("%w: %v is already shortened as %v", interfaces.ErrConflict, link.URL, existing.ShortURL)
+	}
+	return existing, false, nil
+}
+
+// Metrics returns the domains with the most shortened urls, the top three by default
 func (a *API) Metrics(w http.ResponseWriter, r *http.Request) {
-	topThree := a.db.GetTopThreeDomains()
+	query, err := newDomainMetricsQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	topDomains, err := a.db.GetTopDomains(r.Context(), query)
+	if err != nil {
+		log.Printf("Failed to get the top domains. %v", err)
+		writeJSON(w, errorStatus(err), map[string]string{"Error": "Failed to get the metrics!"})
+		return
+	}
 
 	// Using Marshal Indent for formatting the JSON Response
-	jsonResponse, _ := json.MarshalIndent(topThree, "", " ")
+	jsonResponse, _ := json.MarshalIndent(topDomains, "", " ")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	w.Write(jsonResponse)
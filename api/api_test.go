@@ -1,35 +1,67 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/generator"
+	"url-shortener/interfaces"
 	mocks "url-shortener/mocks/interfaces"
 	"url-shortener/models"
+	"url-shortener/monitoring"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// generatorFunc turns a function into a code generator so tests can force collisions
+type generatorFunc func(url string, attempt int) (string, error)
+
+func (f generatorFunc) Generate(url string, attempt int) (string, error) {
+	return f(url, attempt)
+}
+
 func TestAPI(t *testing.T) {
 	testSKNotFound(t)
 	testShortURLNotFound(t)
 	testRedirectURL(t)
+	testRedirectStoreUnavailable(t)
+	testRedirectExpiredURL(t)
 	testMethod(t)
 	testEmptyURL(t)
+	testInvalidURL(t)
+	testTargetPolicy(t)
+	testRedirectBlocked(t)
 	testExistingURL(t)
 	testCreateURL(t)
 	testCreateURLFailedCase(t)
+	testCreateURLCollision(t)
+	testCreateURLConcurrentCase(t)
+	testCreateURLExpiredCase(t)
+	testCreateCanonicalURL(t)
+	testRedirectOriginalURL(t)
 	testTopThreeDomains(t)
+	testTopThreeDomainsFailedCase(t)
+	testTopDomainsWindow(t)
 }
 
 func testSKNotFound(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Missing Short Key Redirect", func(t *testing.T) {
 		shortKey := ""
@@ -46,11 +78,11 @@ func testSKNotFound(t *testing.T) {
 func testShortURLNotFound(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Short URL not Found Redirect", func(t *testing.T) {
 		shortKey := "google.com/7378mDnD"
-		testStore.On("GetByShortURL", shortKey).Return("")
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(nil, interfaces.ErrNotFound)
 
 		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
 		w := httptest.NewRecorder()
@@ -65,11 +97,32 @@ func testShortURLNotFound(t *testing.T) {
 func testRedirectURL(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Redirect Success", func(t *testing.T) {
 		shortKey := "google.com/7378mDnD"
-		testStore.On("GetByShortURL", shortKey).Return("https://www.google.com")
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.google.com"}, nil)
+		testStore.On("RecordClick", mock.Anything, mock.MatchedBy(func(click *models.ClickCollection) bool {
+			return click.ShortURL == shortKey && click.Referrer == "https://www.youtube.com" && click.UserAgent == "test-agent"
+		})).Return(nil).Once()
+
+		hits := monitoring.Redirects.WithLabelValues("hit").Value()
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		req.Header.Set("Referer", "https://www.youtube.com")
+		req.Header.Set("User-Agent", "test-agent")
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, res.StatusCode, http.StatusMovedPermanently)
+		assert.Equal(t, hits+1, monitoring.Redirects.WithLabelValues("hit").Value())
+	})
+
+	t.Run("Redirect Despite Failed Click", func(t *testing.T) {
+		shortKey := "youtube.com/46O6pjZf"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.youtube.com"}, nil)
+		testStore.On("RecordClick", mock.Anything, mock.Anything).Return(interfaces.ErrUnavailable).Once()
 
 		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
 		w := httptest.NewRecorder()
@@ -81,10 +134,49 @@ func testRedirectURL(t *testing.T) {
 	})
 }
 
+func testRedirectStoreUnavailable(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Store Unavailable Redirect", func(t *testing.T) {
+		shortKey := "google.com/7378mDnD"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(nil, interfaces.ErrUnavailable)
+
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+	})
+}
+
+func testRedirectExpiredURL(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Expired Redirect", func(t *testing.T) {
+		shortKey := "google.com/7378mDnD"
+		expiresAt := time.Now().Add(-time.Minute)
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.google.com", ExpiresAt: &expiresAt}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, res.StatusCode, http.StatusGone)
+	})
+}
+
 func testMethod(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Wrong Method", func(t *testing.T) {
 		testURL := "www.google.com"
@@ -107,7 +199,7 @@ func testMethod(t *testing.T) {
 func testEmptyURL(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("URL is Empty", func(t *testing.T) {
 		testURL := ""
@@ -123,17 +215,153 @@ func testEmptyURL(t *testing.T) {
 
 		exData, _ := json.Marshal(map[string]string{"Error": "URL is Empty!"})
 		assert.Equal(t, exData, data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func testInvalidURL(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	tests := map[string]string{
+		"javascript:alert(1)": `url scheme "javascript" is not allowed, use one of http, https`,
+		"https:///path":       "url must contain a host, e.g. https://example.com/path",
+		"www.google.com/" + strings.Repeat("a", maxURLLength): fmt.Sprintf("url must not be longer than %d characters", maxURLLength),
+	}
+	for testURL, message := range tests {
+		t.Run("Invalid URL "+testURL[:min(len(testURL), 20)], func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+			w := httptest.NewRecorder()
+			testAPI.UrlShortner(w, req)
+
+			exData, _ := json.Marshal(map[string]string{"Error": message})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, exData, w.Body.Bytes())
+		})
+	}
+}
+
+func testTargetPolicy(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testPolicy := mocks.NewTargetPolicy(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, testPolicy, nil)
+
+	t.Run("Allowed Target", func(t *testing.T) {
+		testURL := "https://www.google.com"
+		testPolicy.On("Check", mock.Anything, mock.MatchedBy(func(u *url.URL) bool { return u.Host == "www.google.com" })).Return(nil).Once()
+		testStore.On("GetByURL", mock.Anything, testURL).Return(&models.UrlCollection{URL: testURL, ShortURL: "google.com/7378mDnD"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Forbidden Target Is Not Looked Up", func(t *testing.T) {
+		testPolicy.On("Check", mock.Anything, mock.MatchedBy(func(u *url.URL) bool { return u.Host == "localhost:8080" })).
+			Return(fmt.Errorf("%w: host localhost is blocked", interfaces.ErrForbidden)).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/localhost:8080/admin", nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "target not allowed: host localhost is blocked"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("Blocked Target Is Audited", func(t *testing.T) {
+		var audited bytes.Buffer
+		auditLog.SetOutput(&audited)
+		defer auditLog.SetOutput(os.Stderr)
+		testPolicy.On("Check", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: https://evil.example matches \"evil.example\"", interfaces.ErrBlocked)).Once()
+
+		rejected := monitoring.TargetsRejected.WithLabelValues("create").Value()
+		req := httptest.NewRequest(http.MethodPost, "/short/evil.example", nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+		assert.Equal(t, rejected+1, monitoring.TargetsRejected.WithLabelValues("create").Value())
+		assert.Contains(t, audited.String(), `operation=create status=451 client=192.0.2.1:1234 url="https://evil.example"`)
+	})
+
+	t.Run("Resolver Unavailable", func(t *testing.T) {
+		testPolicy.On("Check", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: failed to resolve www.google.com", interfaces.ErrUnavailable)).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/www.google.com", nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "Failed to Shorten the URl!"})
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+}
+
+func testRedirectBlocked(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testPolicy := mocks.NewTargetPolicy(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, testPolicy)
+
+	var audited bytes.Buffer
+	auditLog.SetOutput(&audited)
+	defer auditLog.SetOutput(os.Stderr)
+
+	t.Run("Blocked Target", func(t *testing.T) {
+		shortKey := "evil.example/46O6pjZf"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://login.evil.example/"}, nil).Once()
+		testPolicy.On("Check", mock.Anything, mock.MatchedBy(func(u *url.URL) bool { return u.Host == "login.evil.example" })).
+			Return(fmt.Errorf("%w: https://login.evil.example/ matches \"evil.example\"", interfaces.ErrBlocked)).Once()
+
+		blocked := monitoring.Redirects.WithLabelValues("blocked").Value()
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Equal(t, blocked+1, monitoring.Redirects.WithLabelValues("blocked").Value())
+		assert.Contains(t, audited.String(), `AUDIT operation=redirect status=451 client=192.0.2.1:1234 url="https://login.evil.example/"`)
+	})
+
+	t.Run("Target Not Allowed", func(t *testing.T) {
+		shortKey := "youtube.com/46O6pjZf"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.youtube.com/"}, nil).Once()
+		testPolicy.On("Check", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: https://www.youtube.com/ is not on the allowlist", interfaces.ErrForbidden)).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Allowed Target", func(t *testing.T) {
+		shortKey := "google.com/7378mDnD"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.google.com"}, nil).Once()
+		testStore.On("RecordClick", mock.Anything, mock.Anything).Return(nil).Once()
+		testPolicy.On("Check", mock.Anything, mock.Anything).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
 	})
 }
 
 func testExistingURL(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Get Existing URL", func(t *testing.T) {
 		testURL := "https://www.google.com"
-		testStore.On("GetByURL", testURL).Return("google.com/7378mDnD").Once()
+		testStore.On("GetByURL", mock.Anything, testURL).Return(&models.UrlCollection{URL: testURL, ShortURL: "google.com/7378mDnD"}, nil).Once()
 
 		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
 		w := httptest.NewRecorder()
@@ -153,13 +381,15 @@ func testExistingURL(t *testing.T) {
 func testCreateURL(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Create Short URL", func(t *testing.T) {
 		testURL := "www.google.com"
 		shortURL := "google.com/7378mDnD"
-		testStore.On("GetByURL", "https://"+testURL).Return("").Once()
-		testStore.On("Create", "https://"+testURL, shortURL).Return(true).Once()
+		testStore.On("GetByURL", mock.Anything, "https://"+testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == "https://"+testURL && link.ShortURL == shortURL
+		})).Return(nil).Once()
 
 		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
 		w := httptest.NewRecorder()
@@ -174,17 +404,107 @@ func testCreateURL(t *testing.T) {
 		exData, _ := json.Marshal(map[string]string{"short_url": "google.com/7378mDnD"})
 		assert.Equal(t, exData, data)
 	})
+
+	t.Run("Create Short URL Keeps HTTP", func(t *testing.T) {
+		testURL := "http://intranet/wiki?page=1"
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == testURL
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Create Short URL From Cleaned Path", func(t *testing.T) {
+		testURL := "http://intranet/docs"
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == testURL
+		})).Return(nil).Once()
+
+		// The router redirects /short/http://intranet/docs to the cleaned path
+		req := httptest.NewRequest(http.MethodPost, "/short/http:/intranet/docs", nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Create Short URL Of Other Domain", func(t *testing.T) {
+		testURL := "www.bbc.co.uk/news"
+		testStore.On("GetByURL", mock.Anything, "https://"+testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == "https://"+testURL && strings.HasPrefix(link.ShortURL, "bbc.co.uk/")
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func testCreateCanonicalURL(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{Canonicalize: true, SortQueryParams: true, StripQueryParams: []string{"utm_*"}}, nil, nil)
+
+	t.Run("Create Canonical URL", func(t *testing.T) {
+		testStore.On("GetByURL", mock.Anything, "https://example.com/?a=1&b=2").Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == "https://example.com/?a=1&b=2" && link.OriginalURL == "https://Example.com?b=2&a=1&utm_source=x"
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/https://Example.com?b=2&a=1&utm_source=x", nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	for _, testURL := range []string{"https://Example.com", "https://example.com/", "https://example.com/?utm_source=x", "example.com:443"} {
+		t.Run("Existing Canonical URL "+testURL, func(t *testing.T) {
+			testStore.On("GetByURL", mock.Anything, "https://example.com/").Return(&models.UrlCollection{URL: "https://example.com/", ShortURL: "example.com/5gkn1Amm"}, nil).Once()
+
+			req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+			w := httptest.NewRecorder()
+			testAPI.UrlShortner(w, req)
+
+			exData, _ := json.Marshal(map[string]string{"short_url": "example.com/5gkn1Amm"})
+			assert.Equal(t, exData, w.Body.Bytes())
+		})
+	}
+}
+
+func testRedirectOriginalURL(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Redirect To Original URL", func(t *testing.T) {
+		shortKey := "example.com/5gkn1Amm"
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://example.com/?a=1", OriginalURL: "https://Example.com?a=1&utm_source=x"}, nil)
+		testStore.On("RecordClick", mock.Anything, mock.Anything).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/redirect/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.RedirectURL(w, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://Example.com?a=1&utm_source=x", w.Header().Get("Location"))
+	})
 }
 
 func testCreateURLFailedCase(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Failed to Create Short URL", func(t *testing.T) {
 		testURL := "https://www.google.com"
-		testStore.On("GetByURL", testURL).Return("").Once()
-		testStore.On("Create", testURL, mock.Anything).Return(false).Once()
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.Anything).Return(interfaces.ErrUnavailable).Once()
 
 		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
 		w := httptest.NewRecorder()
@@ -198,13 +518,183 @@ func testCreateURLFailedCase(t *testing.T) {
 
 		exData, _ := json.Marshal(map[string]string{"Error": "Failed to Shorten the URl!"})
 		assert.Equal(t, exData, data)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	})
+}
+
+func testCreateURLCollision(t *testing.T) {
+	testContext := context.Background()
+	testURL := "https://www.google.com"
+	collidingGenerator := generatorFunc(func(url string, attempt int) (string, error) {
+		if attempt < 2 {
+			return "7378mDnD", nil
+		}
+		return fmt.Sprintf("attempt%d", attempt), nil
+	})
+
+	t.Run("Retry Colliding Short URL", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(testContext, testStore, collidingGenerator, config.API{}, nil, nil)
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.ShortURL == "google.com/7378mDnD"
+		})).Return(interfaces.ErrShortURLConflict).Twice()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.ShortURL == "google.com/attempt2"
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"short_url": "google.com/attempt2"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("Give Up After Max Attempts", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(testContext, testStore, generatorFunc(func(url string, attempt int) (string, error) {
+			return "7378mDnD", nil
+		}), config.API{}, nil, nil)
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.Anything).Return(interfaces.ErrShortURLConflict).Times(maxShortenAttempts)
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("Generator Failure", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(testContext, testStore, generatorFunc(func(url string, attempt int) (string, error) {
+			return "", errors.New("failed to read random bytes")
+		}), config.API{}, nil, nil)
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "Failed to Shorten the URl!"})
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+}
+
+func testCreateURLConcurrentCase(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("URL Created Concurrently", func(t *testing.T) {
+		testURL := "https://www.google.com"
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.Anything).Return(interfaces.ErrConflict).Once()
+		testStore.On("GetByURL", mock.Anything, testURL).Return(&models.UrlCollection{URL: testURL, ShortURL: "google.com/7378mDnD"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"short_url": "google.com/7378mDnD"})
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("URL Created Concurrently With Another Code", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(testContext, testStore, generator.NewRandom(8), config.API{}, nil, nil)
+		testURL := "https://www.google.com/x"
+		winner := &models.UrlCollection{URL: testURL, ShortURL: "google.com/winner"}
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.Anything).Return(interfaces.ErrConflict).Once()
+		testStore.On("GetByURL", mock.Anything, testURL).Return(winner, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "https://www.google.com/x"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/redirect/google.com/winner", w.Header().Get("Location"))
+	})
+
+	// Every strategy but the hash gives the racing requests different codes
+	for _, strategy := range []string{generator.Random, generator.Counter, generator.Snowflake} {
+		t.Run("Concurrent Creates With The "+strategy+" Strategy", func(t *testing.T) {
+			codes, err := generator.New(strategy, 8, 1)
+			assert.Nil(t, err)
+			shortURLs := make([]string, 20)
+			store := &racingStore{Store: database.NewStore(testContext)}
+			store.lookups.Add(len(shortURLs))
+			testAPI := NewAPI(testContext, store, codes, config.API{}, nil, nil)
+
+			var wg sync.WaitGroup
+			for i := range shortURLs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					testAPI.UrlShortner(w, httptest.NewRequest(http.MethodPost, "/short/https://www.google.com/race", nil))
+					assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+					res := map[string]string{}
+					assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+					shortURLs[i] = res["short_url"]
+				}(i)
+			}
+			wg.Wait()
+			for _, shortURL := range shortURLs {
+				assert.Equal(t, shortURLs[0], shortURL)
+			}
+		})
+	}
+}
+
+// racingStore holds the requests which did not find their url until every
+// request looked it up, so that all of them race to create it
+type racingStore struct {
+	interfaces.Store
+	lookups sync.WaitGroup
+}
+
+func (s *racingStore) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	link, err := s.Store.GetByURL(ctx, url)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		s.lookups.Done()
+		s.lookups.Wait()
+	}
+	return link, err
+}
+
+func testCreateURLExpiredCase(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Recreate Expired URL", func(t *testing.T) {
+		testURL := "https://www.google.com"
+		expiresAt := time.Now().Add(-time.Minute)
+		expired := &models.UrlCollection{URL: testURL, ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}
+		testStore.On("GetByURL", mock.Anything, testURL).Return(expired, nil).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == testURL && link.ExpiresAt == nil
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/short/"+testURL, nil)
+		w := httptest.NewRecorder()
+		testAPI.UrlShortner(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"short_url": "google.com/7378mDnD"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
 	})
 }
 
 func testTopThreeDomains(t *testing.T) {
 	testContext := context.Background()
 	testStore := mocks.NewStore(t)
-	testAPI := NewAPI(testContext, testStore)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
 
 	t.Run("Top Three Domains", func(t *testing.T) {
 		dmc := []models.DomainMetricsCollection{
@@ -212,7 +702,7 @@ func testTopThreeDomains(t *testing.T) {
 			{Domain: "google.com", Counter: 2},
 			{Domain: "infracloud.com", Counter: 2},
 		}
-		testStore.On("GetTopThreeDomains").Return(dmc).Once()
+		testStore.On("GetTopDomains", mock.Anything, &models.DomainMetricsQuery{Limit: 3}).Return(dmc, nil).Once()
 
 		req := httptest.NewRequest(http.MethodGet, "/metrics/", nil)
 		w := httptest.NewRecorder()
@@ -228,3 +718,62 @@ func testTopThreeDomains(t *testing.T) {
 		assert.Equal(t, exData, data)
 	})
 }
+
+func testTopThreeDomainsFailedCase(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Failed to get Top Three Domains", func(t *testing.T) {
+		testStore.On("GetTopDomains", mock.Anything, mock.Anything).Return(nil, interfaces.ErrUnavailable).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics/", nil)
+		w := httptest.NewRecorder()
+		testAPI.Metrics(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	})
+}
+
+func testTopDomainsWindow(t *testing.T) {
+	testContext := context.Background()
+	testStore := mocks.NewStore(t)
+	testAPI := NewAPI(testContext, testStore, generator.NewHash(8), config.API{}, nil, nil)
+
+	t.Run("Top Ten Domains Of A Week", func(t *testing.T) {
+		dmc := []models.DomainMetricsCollection{{Domain: "youtube.com", Counter: 3}}
+		testStore.On("GetTopDomains", mock.Anything, &models.DomainMetricsQuery{
+			Limit:  10,
+			Offset: 10,
+			Since:  time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC),
+			Until:  time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		}).Return(dmc, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics/?limit=10&offset=10&since=2026-10-11T00:00:00Z&until=2026-10-18T00:00:00Z", nil)
+		w := httptest.NewRecorder()
+		testAPI.Metrics(w, req)
+
+		exData, _ := json.MarshalIndent(dmc, "", " ")
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	invalid := map[string]string{
+		"Limit Too Large":   "limit=101",
+		"Limit Zero":        "limit=0",
+		"Negative Offset":   "offset=-1",
+		"Invalid Since":     "since=last-week",
+		"Invalid Until":     "until=now",
+		"Since After Until": "since=2026-10-18T00:00:00Z&until=2026-10-11T00:00:00Z",
+	}
+	for name, params := range invalid {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics/?"+params, nil)
+			w := httptest.NewRecorder()
+			testAPI.Metrics(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"url-shortener/models"
+)
+
+const (
+	defaultClickInterval = 24 * time.Hour
+	defaultClickWindow   = 7 * 24 * time.Hour
+	minClickInterval     = time.Minute
+	maxClickBuckets      = 1000
+)
+
+// ClickStats returns the total clicks of a short url together with the clicks
+// counted per interval between since and until. Buckets without clicks are
+// returned with a count of zero.
+func (a *API) ClickStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"Error": "Method not Supported!"})
+		return
+	}
+
+	shortKey := r.URL.Path[len("/clicks/"):]
+	if shortKey == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"Error": "Short key is missing"})
+		return
+	}
+
+	query, err := newClickQuery(r, time.Now().UTC())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+	query.ShortURL = shortKey
+
+	if _, err := a.db.GetByShortURL(r.Context(), shortKey); err != nil {
+		status := errorStatus(err)
+		if status == http.StatusNotFound {
+			writeJSON(w, status, map[string]string{"Error": "Shorten URL not found"})
+			return
+		}
+		log.Printf("Failed to resolve %v. %v", shortKey, err)
+		writeJSON(w, status, map[string]string{"Error": "Failed to get the clicks!"})
+		return
+	}
+
+	stats, err := a.db.GetClickStats(r.Context(), query)
+	if err != nil {
+		log.Printf("Failed to get the clicks of %v. %v", shortKey, err)
+		writeJSON(w, errorStatus(err), map[string]string{"Error": "Failed to get the clicks!"})
+		return
+	}
+
+	stats.ShortURL = shortKey
+	stats.Since = query.Since
+	stats.Until = query.Until
+	stats.Interval = query.Interval.String()
+	stats.Buckets = fillBuckets(query, stats.Buckets)
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// newClickQuery reads the since, until and interval query parameters. Without
+// since the window starts a week before until, aligned to the interval.
+func newClickQuery(r *http.Request, now time.Time) (*models.ClickQuery, error) {
+	params := r.URL.Query()
+	query := &models.ClickQuery{Until: now.Truncate(time.Second), Interval: defaultClickInterval}
+
+	if v := params.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minClickInterval {
+			return nil, fmt.Errorf("interval must be a duration of at least %v", minClickInterval)
+		}
+		query.Interval = d
+	}
+	if v := params.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.New("until must be an RFC 3339 timestamp")
+		}
+		query.Until = until.UTC()
+	}
+	query.Since = query.Until.Add(-defaultClickWindow).Truncate(query.Interval)
+	if v := params.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.New("since must be an RFC 3339 timestamp")
+		}
+		query.Since = since.UTC()
+	}
+
+	if !query.Since.Before(query.Until) {
+		return nil, errors.New("since must be before until")
+	}
+	if query.Until.Sub(query.Since)/query.Interval >= maxClickBuckets {
+		return nil, fmt.Errorf("no more than %d buckets can be requested, use a larger interval", maxClickBuckets)
+	}
+	return query, nil
+}
+
+// fillBuckets returns a bucket for every interval of the query, using the
+// counts of the buckets returned by the store
+func fillBuckets(query *models.ClickQuery, buckets []models.ClickBucket) []models.ClickBucket {
+	counts := make(map[int64]int, len(buckets))
+	for _, b := range buckets {
+		counts[b.Start.UnixMilli()] = b.Count
+	}
+
+	filled := []models.ClickBucket{}
+	for start := query.Since; start.Before(query.Until); start = start.Add(query.Interval) {
+		filled = append(filled, models.ClickBucket{Start: start, Count: counts[start.UnixMilli()]})
+	}
+	return filled
+}
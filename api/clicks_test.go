@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/config"
+	"url-shortener/generator"
+	"url-shortener/interfaces"
+	mocks "url-shortener/mocks/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClickStats(t *testing.T) {
+	shortKey := "google.com/7378mDnD"
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Click Stats Success", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.google.com"}, nil).Once()
+		testStore.On("GetClickStats", mock.Anything, &models.ClickQuery{
+			ShortURL: shortKey,
+			Since:    since,
+			Until:    since.Add(3 * time.Hour),
+			Interval: time.Hour,
+		}).Return(&models.ClickStats{Total: 7, Buckets: []models.ClickBucket{{Start: since.Add(time.Hour), Count: 4}}}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/clicks/"+shortKey+"?since=2026-01-01T00:00:00Z&until=2026-01-01T03:00:00Z&interval=1h", nil)
+		w := httptest.NewRecorder()
+		testAPI.ClickStats(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		stats := &models.ClickStats{}
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(stats))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, shortKey, stats.ShortURL)
+		assert.Equal(t, 7, stats.Total)
+		assert.Equal(t, "1h0m0s", stats.Interval)
+		assert.Equal(t, []models.ClickBucket{
+			{Start: since, Count: 0},
+			{Start: since.Add(time.Hour), Count: 4},
+			{Start: since.Add(2 * time.Hour), Count: 0},
+		}, stats.Buckets)
+	})
+
+	t.Run("Unknown Short URL", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(nil, interfaces.ErrNotFound).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/clicks/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.ClickStats(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Store Unavailable", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testStore.On("GetByShortURL", mock.Anything, shortKey).Return(&models.UrlCollection{URL: "https://www.google.com"}, nil).Once()
+		testStore.On("GetClickStats", mock.Anything, mock.Anything).Return(nil, interfaces.ErrUnavailable).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/clicks/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.ClickStats(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("Wrong Method", func(t *testing.T) {
+		testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil)
+		req := httptest.NewRequest(http.MethodPost, "/clicks/"+shortKey, nil)
+		w := httptest.NewRecorder()
+		testAPI.ClickStats(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("Missing Short Key", func(t *testing.T) {
+		testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil)
+		req := httptest.NewRequest(http.MethodGet, "/clicks/", nil)
+		w := httptest.NewRecorder()
+		testAPI.ClickStats(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestNewClickQuery(t *testing.T) {
+	now := time.Date(2026, 1, 10, 15, 30, 0, 0, time.UTC)
+
+	t.Run("Defaults", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/clicks/google.com/7378mDnD", nil)
+		query, err := newClickQuery(req, now)
+		assert.Nil(t, err)
+		assert.Equal(t, now, query.Until)
+		assert.Equal(t, time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), query.Since)
+		assert.Equal(t, 24*time.Hour, query.Interval)
+	})
+
+	invalid := map[string]string{
+		"Invalid Interval":  "interval=soon",
+		"Interval Too Low":  "interval=1s",
+		"Invalid Since":     "since=yesterday",
+		"Invalid Until":     "until=2026-01-01",
+		"Since After Until": "since=2026-01-02T00:00:00Z&until=2026-01-01T00:00:00Z",
+		"Too Many Buckets":  "since=2025-01-01T00:00:00Z&until=2026-01-01T00:00:00Z&interval=1m",
+	}
+	for name, params := range invalid {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/clicks/google.com/7378mDnD?"+params, nil)
+			_, err := newClickQuery(req, now)
+			assert.NotNil(t, err)
+		})
+	}
+}
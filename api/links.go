@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+)
+
+const (
+	maxRequestBodySize = 1 << 20
+	maxURLLength       = 2048
+	maxTags            = 10
+	maxTagLength       = 32
+	minAliasLength     = 3
+	maxAliasLength     = 32
+)
+
+// defaultSchemes are the schemes allowed when api.allowed_schemes is not set
+var defaultSchemes = []string{"http", "https"}
+
+// schemePattern matches the scheme at the start of a url
+var schemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+
+// hostPortPattern matches a url without a scheme which starts with a host and
+// port, e.g. localhost:8080/path, which would otherwise be read as a scheme
+var hostPortPattern = regexp.MustCompile(`^[^:/?#]+:[0-9]+([/?#]|$)`)
+
+// aliasPattern restricts aliases to url safe characters. Generated short urls
+// always contain a "/" so an alias can never clash with one of them.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases are words that cannot be used as an alias as they are, or
+// may become, routes of the service
+var reservedAliases = map[string]bool{
+	"admin":      true,
+	"api":        true,
+	"clicks":     true,
+	"healthz":    true,
+	"links":      true,
+	"metrics":    true,
+	"prometheus": true,
+	"readyz":     true,
+	"redirect":   true,
+	"short":      true,
+	"static":     true,
+}
+
+// CreateLink creates a short link from the JSON body of the request and
+// returns the stored link. An already shortened url returns the existing link.
+func (a *API) CreateLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"Error": "Method not Supported!"})
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != "application/json" {
+			writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"Error": "Content-Type must be application/json"})
+			return
+		}
+	}
+
+	req := &models.CreateLinkRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": fmt.Sprintf("Invalid request body: %v", err)})
+		return
+	}
+
+	link, err := a.newLink(req, time.Now().UTC())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	target := link.URL
+	link, created, err := a.shorten(r.Context(), link)
+	if errors.Is(err, interfaces.ErrForbidden) {
+		audit(r, "create", target, err)
+	}
+	if errors.Is(err, interfaces.ErrShortURLConflict) && req.Alias != "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"Error": "Alias already exists!"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, errorStatus(err), map[string]string{"Error": shortenError(err)})
+		return
+	}
+
+	w.Header().Set("Location", "/redirect/"+link.ShortURL)
+	if !created {
+		writeJSON(w, http.StatusOK, link)
+		return
+	}
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// newLink validates the request and builds the link to be stored from it
+func (a *API) newLink(req *models.CreateLinkRequest, now time.Time) (*models.UrlCollection, error) {
+	target, err := a.validateURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Alias != "" {
+		if err := validateAlias(req.Alias); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(req.Tags) > maxTags {
+		return nil, fmt.Errorf("no more than %d tags are allowed", maxTags)
+	}
+	for _, tag := range req.Tags {
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be between 1 and %d characters", maxTagLength)
+		}
+	}
+
+	link := &models.UrlCollection{
+		URL:       target,
+		ShortURL:  req.Alias,
+		Tags:      req.Tags,
+		CreatedAt: now,
+	}
+
+	switch {
+	case req.ExpiresAt != nil && req.ExpiresIn != "":
+		return nil, errors.New("only one of expires_at and expires_in can be set")
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, errors.New("expires_at must be in the future")
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	case req.ExpiresIn != "":
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			return nil, errors.New("expires_in must be a positive duration such as 24h")
+		}
+		expiresAt := now.Add(d)
+		link.ExpiresAt = &expiresAt
+	}
+
+	return link, nil
+}
+
+// validateURL checks that the url can be shortened and returns it with the
+// scheme added when it has none. The error describes what is wrong with the url.
+func (a *API) validateURL(rawURL string) (string, error) {
+	target := strings.TrimSpace(rawURL)
+	if target == "" {
+		return "", errors.New("url is required")
+	}
+	if len(target) > a.maxURLLength {
+		return "", fmt.Errorf("url must not be longer than %d characters", a.maxURLLength)
+	}
+	if !schemePattern.MatchString(target) || hostPortPattern.MatchString(target) {
+		target = "https://" + target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("url is malformed: %v", err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !a.schemes[scheme] {
+		return "", fmt.Errorf("url scheme %q is not allowed, use one of %v", scheme, strings.Join(a.allowedSchemes(), ", "))
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", errors.New("url must contain a host, e.g. https://example.com/path")
+	}
+	return target, nil
+}
+
+// allowedSchemes returns the allowed schemes in order
+func (a *API) allowedSchemes() []string {
+	schemes := make([]string, 0, len(a.schemes))
+	for scheme := range a.schemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// validateAlias checks that a requested alias can be used as a short url
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("alias must be between %d and %d characters", minAliasLength, maxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("alias may only contain letters, digits, '-' and '_'")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/config"
+	"url-shortener/generator"
+	"url-shortener/interfaces"
+	mocks "url-shortener/mocks/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateLink(t *testing.T) {
+	t.Run("Create Link Success", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testURL := "https://www.google.com/search?q=go#top"
+		testStore.On("GetByURL", mock.Anything, testURL).Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.URL == testURL && link.ShortURL != "" && link.ExpiresAt != nil
+		})).Return(nil).Once()
+
+		body := `{"url": "https://www.google.com/search?q=go#top", "expires_in": "24h", "tags": ["search"]}`
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		link := &models.UrlCollection{}
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(link))
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		assert.Equal(t, testURL, link.URL)
+		assert.Equal(t, []string{"search"}, link.Tags)
+		assert.Equal(t, "/redirect/"+link.ShortURL, res.Header.Get("Location"))
+	})
+
+	t.Run("Existing Link", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		existing := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}
+		testStore.On("GetByURL", mock.Anything, existing.URL).Return(existing, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "www.google.com"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		link := &models.UrlCollection{}
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(link))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, existing.ShortURL, link.ShortURL)
+	})
+
+	t.Run("Target Rejected By Policy", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testPolicy := mocks.NewTargetPolicy(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, testPolicy, nil)
+		testPolicy.On("Check", mock.Anything, mock.MatchedBy(func(u *url.URL) bool {
+			return u.Host == "169.254.169.254"
+		})).Return(fmt.Errorf("%w: 169.254.169.254 resolves to the private address 169.254.169.254", interfaces.ErrForbidden)).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "http://169.254.169.254/latest/meta-data/"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "target not allowed: 169.254.169.254 resolves to the private address 169.254.169.254"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("Create Link With Alias", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testStore.On("GetByURL", mock.Anything, "https://www.launch.com").Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.MatchedBy(func(link *models.UrlCollection) bool {
+			return link.ShortURL == "launch2026"
+		})).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "www.launch.com", "alias": "launch2026"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/redirect/launch2026", w.Header().Get("Location"))
+	})
+
+	t.Run("Alias Already Exists", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		testStore.On("GetByURL", mock.Anything, "https://www.launch.com").Return(nil, interfaces.ErrNotFound).Once()
+		testStore.On("Create", mock.Anything, mock.Anything).Return(interfaces.ErrShortURLConflict).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "www.launch.com", "alias": "launch2026"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "Alias already exists!"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("URL Shortened With Another Alias", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testAPI := NewAPI(context.Background(), testStore, generator.NewHash(8), config.API{}, nil, nil)
+		existing := &models.UrlCollection{URL: "https://www.launch.com", ShortURL: "launch.com/7378mDnD"}
+		testStore.On("GetByURL", mock.Anything, existing.URL).Return(existing, nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(`{"url": "www.launch.com", "alias": "launch2026"}`))
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		exData, _ := json.Marshal(map[string]string{"Error": "entry already exists: https://www.launch.com is already shortened as launch.com/7378mDnD"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, exData, w.Body.Bytes())
+	})
+
+	t.Run("Wrong Method", func(t *testing.T) {
+		testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil)
+		req := httptest.NewRequest(http.MethodGet, "/links", nil)
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+	})
+
+	t.Run("Wrong Content Type", func(t *testing.T) {
+		testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil)
+		req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader("url=www.google.com"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		testAPI.CreateLink(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	invalid := map[string]string{
+		"Malformed JSON":     `{"url": `,
+		"Unknown Field":      `{"url": "www.google.com", "owner": "me"}`,
+		"Missing URL":        `{"tags": ["a"]}`,
+		"Missing Host":       `{"url": "https://"}`,
+		"Both Expiries":      `{"url": "www.google.com", "expires_in": "1h", "expires_at": "2030-01-01T00:00:00Z"}`,
+		"Expiry In The Past": `{"url": "www.google.com", "expires_at": "2001-01-01T00:00:00Z"}`,
+		"Invalid Duration":   `{"url": "www.google.com", "expires_in": "-1h"}`,
+		"Empty Tag":          `{"url": "www.google.com", "tags": [""]}`,
+		"Tag Too Long":       `{"url": "www.google.com", "tags": ["` + strings.Repeat("a", maxTagLength+1) + `"]}`,
+		"URL Too Long":       `{"url": "www.google.com/` + strings.Repeat("a", maxURLLength) + `"}`,
+		"Scheme Not Allowed": `{"url": "javascript:alert(1)"}`,
+		"Too Many Tags":      `{"url": "www.google.com", "tags": ["a","b","c","d","e","f","g","h","i","j","k"]}`,
+		"Reserved Alias":     `{"url": "www.google.com", "alias": "Metrics"}`,
+		"Invalid Alias":      `{"url": "www.google.com", "alias": "a/b"}`,
+		"Blank URL":          `{"url": "   "}`,
+	}
+	for name, body := range invalid {
+		t.Run(name, func(t *testing.T) {
+			testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil)
+			req := httptest.NewRequest(http.MethodPost, "/links", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			testAPI.CreateLink(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestNewLink(t *testing.T) {
+	testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{}, nil, nil).(*API)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Infers Scheme And Expiry", func(t *testing.T) {
+		link, err := testAPI.newLink(&models.CreateLinkRequest{URL: "www.google.com", ExpiresIn: "2h", Alias: "launch"}, now)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://www.google.com", link.URL)
+		assert.Equal(t, "launch", link.ShortURL)
+		assert.Equal(t, now.Add(2*time.Hour), *link.ExpiresAt)
+		assert.Equal(t, now, link.CreatedAt)
+	})
+
+	t.Run("Keeps Query And Fragment", func(t *testing.T) {
+		link, err := testAPI.newLink(&models.CreateLinkRequest{URL: "https://example.com/a/short/b?x=1#frag"}, now)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com/a/short/b?x=1#frag", link.URL)
+		assert.Nil(t, link.ExpiresAt)
+	})
+}
+
+func TestValidateURL(t *testing.T) {
+	testAPI := NewAPI(context.Background(), mocks.NewStore(t), generator.NewHash(8), config.API{AllowedSchemes: []string{"http", "HTTPS", "ftp"}, MaxURLLength: 40}, nil, nil).(*API)
+	valid := []struct {
+		url  string
+		want string
+	}{
+		{url: "www.google.com", want: "https://www.google.com"},
+		{url: "  www.google.com/a?b=c  ", want: "https://www.google.com/a?b=c"},
+		{url: "http://intranet/wiki", want: "http://intranet/wiki"},
+		{url: "HTTPS://www.google.com", want: "HTTPS://www.google.com"},
+		{url: "ftp://files.example.com/a", want: "ftp://files.example.com/a"},
+		{url: "localhost:8080/path", want: "https://localhost:8080/path"},
+		{url: "localhost:8080", want: "https://localhost:8080"},
+		{url: "[::1]:8080/path", want: "https://[::1]:8080/path"},
+	}
+	for _, tt := range valid {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := testAPI.validateURL(tt.url)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []struct {
+		url  string
+		want string
+	}{
+		{url: "", want: "url is required"},
+		{url: "https://www.google.com/" + strings.Repeat("a", 20), want: "url must not be longer than 40 characters"},
+		{url: "javascript:alert(1)", want: `url scheme "javascript" is not allowed, use one of ftp, http, https`},
+		{url: "mailto:someone@example.com", want: `url scheme "mailto" is not allowed, use one of ftp, http, https`},
+		{url: "file:///etc/passwd", want: `url scheme "file" is not allowed, use one of ftp, http, https`},
+		{url: "http:intranet", want: "url must contain a host, e.g. https://example.com/path"},
+		{url: "https://", want: "url must contain a host, e.g. https://example.com/path"},
+		{url: "https://:8080/path", want: "url must contain a host, e.g. https://example.com/path"},
+		{url: "https://exa mple.com", want: `url is malformed: parse "https://exa mple.com": invalid character " " in host name`},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := testAPI.validateURL(tt.url)
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{name: "Valid Alias", alias: "launch2026", wantErr: false},
+		{name: "Dashes And Underscores", alias: "spring_sale-2026", wantErr: false},
+		{name: "Too Short", alias: "ab", wantErr: true},
+		{name: "Too Long", alias: strings.Repeat("a", maxAliasLength+1), wantErr: true},
+		{name: "Slash", alias: "google.com/abc", wantErr: true},
+		{name: "Space", alias: "launch 2026", wantErr: true},
+		{name: "Non ASCII", alias: "läunch", wantErr: true},
+		{name: "Reserved", alias: "redirect", wantErr: true},
+		{name: "Reserved Mixed Case", alias: "HealthZ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAlias(tt.alias); (err != nil) != tt.wantErr {
+				t.Errorf("validateAlias() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
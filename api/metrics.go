@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shortener/models"
+)
+
+const (
+	defaultMetricsLimit = 3
+	maxMetricsLimit     = 100
+)
+
+// newDomainMetricsQuery reads the limit, offset, since and until query parameters
+func newDomainMetricsQuery(r *http.Request) (*models.DomainMetricsQuery, error) {
+	params := r.URL.Query()
+	query := &models.DomainMetricsQuery{Limit: defaultMetricsLimit}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxMetricsLimit {
+			return nil, fmt.Errorf("limit must be a number between 1 and %d", maxMetricsLimit)
+		}
+		query.Limit = limit
+	}
+	if v := params.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a number of at least 0")
+		}
+		query.Offset = offset
+	}
+	if v := params.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.New("since must be an RFC 3339 timestamp")
+		}
+		query.Since = since.UTC()
+	}
+	if v := params.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.New("until must be an RFC 3339 timestamp")
+		}
+		query.Until = until.UTC()
+	}
+
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		return nil, errors.New("since must be before until")
+	}
+	return query, nil
+}
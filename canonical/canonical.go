@@ -0,0 +1,191 @@
+// Package canonical rewrites urls into a canonical form, so that urls which
+// point to the same resource are shortened once.
+package canonical
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Options selects the optional steps of the pipeline
+type Options struct {
+	// SortQuery orders the query parameters by name, parameters with the same
+	// name keep their order
+	SortQuery bool
+	// StripParams are the query parameters which are removed, e.g. tracking
+	// parameters. A trailing * matches every parameter with that prefix.
+	StripParams []string
+}
+
+// Canonicalizer applies the pipeline to urls
+type Canonicalizer struct {
+	opts Options
+}
+
+// New returns a canonicalizer with the given options
+func New(opts Options) *Canonicalizer {
+	return &Canonicalizer{opts: opts}
+}
+
+// defaultPorts are removed from the host of urls with the scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Canonicalize returns the canonical form of the absolute url. The scheme and
+// host are lowercased, the default port is removed, the path is normalized and
+// the query parameters are stripped and sorted as configured. The fragment is
+// kept as it is.
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url %q has no host", rawURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	escaped := removeDotSegments(normalizeEscapes(u.EscapedPath()))
+	if escaped == "" {
+		escaped = "/"
+	}
+	if u.Path, err = url.PathUnescape(escaped); err != nil {
+		return "", err
+	}
+	u.RawPath = escaped
+
+	u.RawQuery = c.query(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// query strips and sorts the parameters of the raw query
+func (c *Canonicalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ name, raw string }
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if c.stripped(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: normalizeEscapes(raw)})
+	}
+	if c.opts.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	raw := make([]string, len(params))
+	for i, p := range params {
+		raw[i] = p.raw
+	}
+	return strings.Join(raw, "&")
+}
+
+// stripped reports whether the parameter is removed from the query
+func (c *Canonicalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range c.opts.StripParams {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes decodes the percent escapes of unreserved characters, which
+// never need to be escaped, and uppercases the hex digits of the others
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves the "." and ".." segments of the path as
+// described in RFC 3986, section 5.2.4. A trailing slash is kept.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// The first segment is the empty one before the leading slash
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,69 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalize(t *testing.T) {
+	c := New(Options{SortQuery: true, StripParams: []string{"utm_*", "fbclid"}})
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "Already Canonical", url: "https://example.com/a/b?x=1", want: "https://example.com/a/b?x=1"},
+		{name: "Lowercase Scheme And Host", url: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "Empty Path", url: "https://example.com", want: "https://example.com/"},
+		{name: "Default HTTPS Port", url: "https://example.com:443/", want: "https://example.com/"},
+		{name: "Default HTTP Port", url: "http://example.com:80/", want: "http://example.com/"},
+		{name: "Other Port", url: "https://example.com:8443/", want: "https://example.com:8443/"},
+		{name: "HTTP Port On HTTPS", url: "https://example.com:80/", want: "https://example.com:80/"},
+		{name: "Trailing Dot", url: "https://example.com./", want: "https://example.com/"},
+		{name: "IPv6", url: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "Dot Segments", url: "https://example.com/a/./b/../c", want: "https://example.com/a/c"},
+		{name: "Dot Segments Above Root", url: "https://example.com/../../a", want: "https://example.com/a"},
+		{name: "Trailing Dot Segment", url: "https://example.com/a/b/..", want: "https://example.com/a/"},
+		{name: "Trailing Slash Kept", url: "https://example.com/a/", want: "https://example.com/a/"},
+		{name: "Unreserved Escapes Decoded", url: "https://example.com/%7Euser/%61", want: "https://example.com/~user/a"},
+		{name: "Escapes Uppercased", url: "https://example.com/a%2fb?q=%e2%82%ac", want: "https://example.com/a%2Fb?q=%E2%82%AC"},
+		{name: "Tracking Parameters Stripped", url: "https://example.com/?utm_source=x&id=1&UTM_Medium=y&fbclid=z", want: "https://example.com/?id=1"},
+		{name: "Only Tracking Parameters", url: "https://example.com/?utm_source=x", want: "https://example.com/"},
+		{name: "Query Sorted", url: "https://example.com/?b=2&a=1&c=3", want: "https://example.com/?a=1&b=2&c=3"},
+		{name: "Repeated Parameters Keep Their Order", url: "https://example.com/?b=2&a=z&a=y", want: "https://example.com/?a=z&a=y&b=2"},
+		{name: "Empty Query", url: "https://example.com/?", want: "https://example.com/"},
+		{name: "Empty Parameters Dropped", url: "https://example.com/?a=1&&b=2", want: "https://example.com/?a=1&b=2"},
+		{name: "Fragment Kept", url: "https://example.com/#Section", want: "https://example.com/#Section"},
+		{name: "Credentials Kept", url: "https://User@Example.com/", want: "https://User@example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Canonicalize(tt.url)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCanonicalizeOptions(t *testing.T) {
+	t.Run("Nothing Stripped Or Sorted", func(t *testing.T) {
+		got, err := New(Options{}).Canonicalize("https://Example.com?utm_source=x&b=2&a=1")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com/?utm_source=x&b=2&a=1", got)
+	})
+	t.Run("Exact Parameter Names", func(t *testing.T) {
+		got, err := New(Options{StripParams: []string{"ref"}}).Canonicalize("https://example.com/?ref=a&referrer=b")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com/?referrer=b", got)
+	})
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	for _, url := range []string{"https://[::1", "/relative/path", "mailto:someone@example.com"} {
+		t.Run(url, func(t *testing.T) {
+			_, err := New(Options{}).Canonicalize(url)
+			assert.NotNil(t, err)
+		})
+	}
+}
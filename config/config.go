@@ -0,0 +1,363 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"url-shortener/generator"
+	"url-shortener/policy"
+
+	"github.com/magiconair/properties"
+)
+
+// Backends which can be selected with store.backend
+const (
+	BackendMemory   = "memory"
+	BackendMongo    = "mongo"
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+	BackendBolt     = "bolt"
+	BackendRedis    = "redis"
+)
+
+// schemePattern matches the syntax of a url scheme
+var schemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*$`)
+
+// envPrefix is prepended to the environment variable of every key, e.g.
+// server.addr is read from URL_SHORTENER_SERVER_ADDR
+const envPrefix = "URL_SHORTENER_"
+
+// Config holds the settings of the service
+type Config struct {
+	Server    Server    `properties:"server"`
+	API       API       `properties:"api"`
+	Store     Store     `properties:"store"`
+	Mongo     Mongo     `properties:"mongo"`
+	SQLite    SQLite    `properties:"sqlite"`
+	Postgres  Postgres  `properties:"postgres"`
+	Bolt      Bolt      `properties:"bolt"`
+	Redis     Redis     `properties:"redis"`
+	Cache     Cache     `properties:"cache"`
+	Generator Generator `properties:"generator"`
+}
+
+type Server struct {
+	Addr         string        `properties:"addr,default=:8080"`
+	ReadTimeout  time.Duration `properties:"read_timeout,default=5s"`
+	WriteTimeout time.Duration `properties:"write_timeout,default=10s"`
+	IdleTimeout  time.Duration `properties:"idle_timeout,default=60s"`
+	// ShutdownDelay is how long the server keeps serving while reporting that
+	// it is not ready, before it starts draining the connections
+	ShutdownDelay time.Duration `properties:"shutdown_delay,default=5s"`
+	// ShutdownTimeout is the deadline for draining the connections, and then
+	// again for closing the store
+	ShutdownTimeout time.Duration `properties:"shutdown_timeout,default=15s"`
+	// ReadinessTimeout bounds the checks of the dependencies done by /readyz
+	ReadinessTimeout time.Duration `properties:"readiness_timeout,default=2s"`
+}
+
+// API configures how the urls are shortened
+type API struct {
+	// Canonicalize rewrites the urls into their canonical form before they
+	// are looked up and stored, the redirect still goes to the url as given
+	Canonicalize    bool `properties:"canonicalize,default=true"`
+	SortQueryParams bool `properties:"sort_query_params,default=true"`
+	// StripQueryParams are removed from the canonical url, a trailing *
+	// matches every parameter with that prefix
+	StripQueryParams []string `properties:"strip_query_params,default=utm_*;fbclid;gclid;msclkid"`
+	// AllowedSchemes are the schemes of the urls which can be shortened,
+	// https:// is added to urls without a scheme
+	AllowedSchemes []string `properties:"allowed_schemes,default=http;https"`
+	MaxURLLength   int      `properties:"max_url_length,default=2048"`
+	// BlockPrivateTargets rejects the urls of hosts which resolve to private
+	// addresses, BlockedNetworks and BlockedHosts are rejected as well
+	BlockPrivateTargets bool          `properties:"block_private_targets,default=false"`
+	BlockedNetworks     []string      `properties:"blocked_networks,default="`
+	BlockedHosts        []string      `properties:"blocked_hosts,default="`
+	ResolveTimeout      time.Duration `properties:"resolve_timeout,default=2s"`
+	// DenylistFile and AllowlistFile are the files of the domains and url
+	// patterns which are blocked and allowed, they are read again every
+	// ListsReloadInterval once they changed
+	DenylistFile        string        `properties:"denylist_file,default="`
+	AllowlistFile       string        `properties:"allowlist_file,default="`
+	ListsReloadInterval time.Duration `properties:"lists_reload_interval,default=30s"`
+}
+
+// NetworkPolicy reports whether the urls are checked by a network policy
+func (a API) NetworkPolicy() bool {
+	return a.BlockPrivateTargets || len(a.BlockedNetworks) > 0 || len(a.BlockedHosts) > 0
+}
+
+type Store struct {
+	Backend string `properties:"backend,default=mongo"`
+}
+
+type Mongo struct {
+	URI                    string        `properties:"uri,default=mongodb://localhost:27017"`
+	Database               string        `properties:"database,default=url-shortner"`
+	ConnectTimeout         time.Duration `properties:"connect_timeout,default=10s"`
+	ServerSelectionTimeout time.Duration `properties:"server_selection_timeout,default=5s"`
+	MaxPoolSize            int           `properties:"max_pool_size,default=100"`
+	// Username, Password and AuthSource override the credentials of the URI
+	Username   string `properties:"username,default="`
+	Password   string `properties:"password,default="`
+	AuthSource string `properties:"auth_source,default="`
+	TLS        bool   `properties:"tls,default=false"`
+	TLSCAFile  string `properties:"tls_ca_file,default="`
+	// PingAttempts is how often mongodb is pinged on start up before giving
+	// up, the wait between the attempts starts at PingBackoff and doubles
+	PingAttempts int           `properties:"ping_attempts,default=5"`
+	PingBackoff  time.Duration `properties:"ping_backoff,default=500ms"`
+}
+
+type SQLite struct {
+	Path string `properties:"path,default=url-shortener.db"`
+}
+
+type Postgres struct {
+	DSN          string `properties:"dsn,default=postgres://localhost:5432/url_shortener?sslmode=disable"`
+	MaxOpenConns int    `properties:"max_open_conns,default=10"`
+}
+
+type Bolt struct {
+	Path string `properties:"path,default=url-shortener.bolt"`
+	// BackupPath is where the file is copied every BackupInterval, backups
+	// are disabled when it is empty
+	BackupPath     string        `properties:"backup_path,default="`
+	BackupInterval time.Duration `properties:"backup_interval,default=1h"`
+}
+
+type Redis struct {
+	URL string `properties:"url,default=redis://localhost:6379/0"`
+	// KeyPrefix is prepended to every key, so that several deployments can
+	// share a redis. Its hash tag keeps the keys in one slot of a cluster.
+	KeyPrefix string `properties:"key_prefix,default={url-shortener}:"`
+}
+
+// Cache is the link cache in front of the store, it is disabled when Size is 0
+type Cache struct {
+	Size int           `properties:"size,default=10000"`
+	TTL  time.Duration `properties:"ttl,default=5m"`
+	// NegativeTTL is how long unknown links are cached, 0 disables it
+	NegativeTTL time.Duration `properties:"negative_ttl,default=5s"`
+}
+
+type Generator struct {
+	Strategy string `properties:"strategy,default=hash"`
+	Length   int    `properties:"length,default=8"`
+	NodeID   int64  `properties:"node_id,default=0"`
+}
+
+// keys are the properties which can be overridden by environment variables and flags
+var keys = []struct {
+	name  string
+	usage string
+}{
+	{"server.addr", "address the HTTP server listens on (default :8080)"},
+	{"server.read_timeout", "maximum duration for reading a request (default 5s)"},
+	{"server.write_timeout", "maximum duration for writing a response (default 10s)"},
+	{"server.idle_timeout", "maximum duration a keep-alive connection is kept idle (default 60s)"},
+	{"server.shutdown_delay", "duration the server reports not ready before draining on shutdown (default 5s)"},
+	{"server.shutdown_timeout", "deadline for draining connections and closing the store on shutdown (default 15s)"},
+	{"server.readiness_timeout", "deadline for checking the dependencies on /readyz (default 2s)"},
+	{"api.canonicalize", "whether urls are canonicalized before they are deduplicated (default true)"},
+	{"api.sort_query_params", "whether the query parameters of the canonical url are sorted (default true)"},
+	{"api.strip_query_params", "query parameters removed from the canonical url separated by ;, a trailing * matches a prefix (default utm_*;fbclid;gclid;msclkid)"},
+	{"api.allowed_schemes", "schemes of the urls which can be shortened separated by ; (default http;https)"},
+	{"api.max_url_length", "maximum length of the urls which can be shortened (default 2048)"},
+	{"api.block_private_targets", "whether urls of loopback, link-local and private addresses are rejected (default false)"},
+	{"api.blocked_networks", "CIDRs separated by ; the urls of which are rejected"},
+	{"api.blocked_hosts", "hosts separated by ; the urls of which are rejected, along with their subdomains"},
+	{"api.resolve_timeout", "deadline for resolving the host of a url checked by the target policy (default 2s)"},
+	{"api.denylist_file", "file of the domains and url patterns which cannot be shortened or redirected to"},
+	{"api.allowlist_file", "file of the only domains and url patterns which can be shortened and redirected to"},
+	{"api.lists_reload_interval", "interval the list files are checked for changes (default 30s)"},
+	{"store.backend", "storage backend: memory, mongo, sqlite, postgres, bolt or redis (default mongo)"},
+	{"mongo.uri", "connection string of mongodb (default mongodb://localhost:27017)"},
+	{"mongo.database", "name of the mongodb database (default url-shortner)"},
+	{"mongo.connect_timeout", "maximum duration for connecting to mongodb (default 10s)"},
+	{"mongo.server_selection_timeout", "maximum duration an operation waits for a mongodb server (default 5s)"},
+	{"mongo.max_pool_size", "maximum number of connections to mongodb (default 100)"},
+	{"mongo.username", "user authenticating to mongodb, overrides the credentials of the uri"},
+	{"mongo.password", "password of mongo.username"},
+	{"mongo.auth_source", "database mongo.username is defined in (default the one of the uri)"},
+	{"mongo.tls", "whether to connect to mongodb over TLS (default false)"},
+	{"mongo.tls_ca_file", "PEM file of the certificates verifying mongodb, the system roots when empty"},
+	{"mongo.ping_attempts", "number of times mongodb is pinged on start up (default 5)"},
+	{"mongo.ping_backoff", "initial wait between the pings on start up, doubled after every attempt (default 500ms)"},
+	{"sqlite.path", "path of the database file of the sqlite backend (default url-shortener.db)"},
+	{"postgres.dsn", "connection string of postgres (default postgres://localhost:5432/url_shortener?sslmode=disable)"},
+	{"postgres.max_open_conns", "maximum number of connections to postgres (default 10)"},
+	{"bolt.path", "path of the database file of the bolt backend (default url-shortener.bolt)"},
+	{"bolt.backup_path", "path the bolt database is backed up to, backups are disabled when empty"},
+	{"bolt.backup_interval", "interval of the backups of the bolt database (default 1h)"},
+	{"redis.url", "connection string of redis, rediss:// for TLS (default redis://localhost:6379/0)"},
+	{"redis.key_prefix", "prefix of the keys of the redis backend (default {url-shortener}:)"},
+	{"cache.size", "number of links kept in the cache in front of the store, 0 disables it (default 10000)"},
+	{"cache.ttl", "duration a link is cached (default 5m)"},
+	{"cache.negative_ttl", "duration a link which is not found is cached, 0 disables it (default 5s)"},
+	{"generator.strategy", "short code generator: hash, random, counter or snowflake (default hash)"},
+	{"generator.length", "length of the generated short codes (default 8)"},
+	{"generator.node_id", "node id of this replica, used by the snowflake generator (default 0)"},
+}
+
+// Load reads the configuration. Every key has a default value which is
+// overridden by the properties file given with -config or URL_SHORTENER_CONFIG,
+// then by the URL_SHORTENER_ environment variable of the key and finally by
+// the flag of the same name as the key.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("url-shortener", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path of the properties file")
+	for _, k := range keys {
+		fs.String(k.name, "", k.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	p := properties.NewProperties()
+	if *file != "" {
+		var err error
+		p, err = properties.LoadFile(*file, properties.UTF8)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %v: %w", *file, err)
+		}
+	}
+
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(EnvName(k.name)); ok {
+			if _, _, err := p.Set(k.name, v); err != nil {
+				return nil, fmt.Errorf("invalid value for %v: %w", EnvName(k.name), err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		_, _, err = p.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag value: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := p.Decode(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// EnvName returns the environment variable which overrides the key
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Validate checks that the values of the configuration can be used
+func (c *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		return fmt.Errorf("server.addr %q is not a valid address: %v", c.Server.Addr, err)
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 || c.Server.ReadinessTimeout <= 0 {
+		return fmt.Errorf("server timeouts must be positive")
+	}
+	if c.Server.ShutdownDelay < 0 {
+		return fmt.Errorf("server.shutdown_delay must not be negative")
+	}
+
+	if len(c.API.AllowedSchemes) == 0 {
+		return fmt.Errorf("api.allowed_schemes must not be empty")
+	}
+	for _, scheme := range c.API.AllowedSchemes {
+		if !schemePattern.MatchString(scheme) {
+			return fmt.Errorf("api.allowed_schemes contains the invalid scheme %q", scheme)
+		}
+	}
+	if c.API.MaxURLLength < 1 {
+		return fmt.Errorf("api.max_url_length must be positive")
+	}
+	if _, err := policy.ParsePrefixes(c.API.BlockedNetworks); err != nil {
+		return fmt.Errorf("api.blocked_networks is invalid: %v", err)
+	}
+	if c.API.NetworkPolicy() && c.API.ResolveTimeout <= 0 {
+		return fmt.Errorf("api.resolve_timeout must be positive")
+	}
+	if (c.API.DenylistFile != "" || c.API.AllowlistFile != "") && c.API.ListsReloadInterval <= 0 {
+		return fmt.Errorf("api.lists_reload_interval must be positive")
+	}
+
+	switch c.Store.Backend {
+	case BackendMemory:
+	case BackendMongo:
+		if !strings.HasPrefix(c.Mongo.URI, "mongodb://") && !strings.HasPrefix(c.Mongo.URI, "mongodb+srv://") {
+			return fmt.Errorf("mongo.uri must start with mongodb:// or mongodb+srv://")
+		}
+		if c.Mongo.Database == "" || strings.ContainsAny(c.Mongo.Database, `/\. "$*<>:|?`) {
+			return fmt.Errorf("mongo.database %q is not a valid database name", c.Mongo.Database)
+		}
+		if c.Mongo.ConnectTimeout <= 0 || c.Mongo.ServerSelectionTimeout <= 0 {
+			return fmt.Errorf("mongo timeouts must be positive")
+		}
+		if c.Mongo.MaxPoolSize < 1 {
+			return fmt.Errorf("mongo.max_pool_size must be positive")
+		}
+		if c.Mongo.Username == "" && (c.Mongo.Password != "" || c.Mongo.AuthSource != "") {
+			return fmt.Errorf("mongo.username is required with mongo.password or mongo.auth_source")
+		}
+		if c.Mongo.TLSCAFile != "" && !c.Mongo.TLS {
+			return fmt.Errorf("mongo.tls_ca_file requires mongo.tls")
+		}
+		if c.Mongo.PingAttempts < 1 || c.Mongo.PingBackoff < 0 {
+			return fmt.Errorf("mongo.ping_attempts must be positive and mongo.ping_backoff must not be negative")
+		}
+	case BackendSQLite:
+		if c.SQLite.Path == "" {
+			return fmt.Errorf("sqlite.path is required")
+		}
+	case BackendPostgres:
+		if !strings.HasPrefix(c.Postgres.DSN, "postgres://") && !strings.HasPrefix(c.Postgres.DSN, "postgresql://") {
+			return fmt.Errorf("postgres.dsn must start with postgres:// or postgresql://")
+		}
+		if c.Postgres.MaxOpenConns < 1 {
+			return fmt.Errorf("postgres.max_open_conns must be positive")
+		}
+	case BackendBolt:
+		if c.Bolt.Path == "" {
+			return fmt.Errorf("bolt.path is required")
+		}
+		if c.Bolt.BackupPath != "" && c.Bolt.BackupInterval <= 0 {
+			return fmt.Errorf("bolt.backup_interval must be positive")
+		}
+		if c.Bolt.BackupPath == c.Bolt.Path {
+			return fmt.Errorf("bolt.backup_path must differ from bolt.path")
+		}
+	case BackendRedis:
+		if !strings.HasPrefix(c.Redis.URL, "redis://") && !strings.HasPrefix(c.Redis.URL, "rediss://") {
+			return fmt.Errorf("redis.url must start with redis:// or rediss://")
+		}
+	default:
+		return fmt.Errorf("store.backend must be one of %v, %v, %v, %v, %v or %v, got %q",
+			BackendMemory, BackendMongo, BackendSQLite, BackendPostgres, BackendBolt, BackendRedis, c.Store.Backend)
+	}
+
+	if c.Cache.Size < 0 {
+		return fmt.Errorf("cache.size must not be negative")
+	}
+	if c.Cache.Size > 0 && (c.Cache.TTL <= 0 || c.Cache.NegativeTTL < 0) {
+		return fmt.Errorf("cache.ttl must be positive and cache.negative_ttl must not be negative")
+	}
+
+	if _, err := generator.New(c.Generator.Strategy, c.Generator.Length, c.Generator.NodeID); err != nil {
+		return fmt.Errorf("invalid generator settings: %v", err)
+	}
+	return nil
+}
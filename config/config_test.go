@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "url-shortener.properties")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %v: %v", path, err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &Config{
+		Server: Server{
+			Addr:             ":8080",
+			ReadTimeout:      5 * time.Second,
+			WriteTimeout:     10 * time.Second,
+			IdleTimeout:      60 * time.Second,
+			ShutdownDelay:    5 * time.Second,
+			ShutdownTimeout:  15 * time.Second,
+			ReadinessTimeout: 2 * time.Second,
+		},
+		API: API{
+			Canonicalize:        true,
+			SortQueryParams:     true,
+			StripQueryParams:    []string{"utm_*", "fbclid", "gclid", "msclkid"},
+			AllowedSchemes:      []string{"http", "https"},
+			MaxURLLength:        2048,
+			BlockedNetworks:     []string{},
+			BlockedHosts:        []string{},
+			ResolveTimeout:      2 * time.Second,
+			ListsReloadInterval: 30 * time.Second,
+		},
+		Store: Store{Backend: BackendMongo},
+		Mongo: Mongo{
+			URI:                    "mongodb://localhost:27017",
+			Database:               "url-shortner",
+			ConnectTimeout:         10 * time.Second,
+			ServerSelectionTimeout: 5 * time.Second,
+			MaxPoolSize:            100,
+			PingAttempts:           5,
+			PingBackoff:            500 * time.Millisecond,
+		},
+		SQLite:    SQLite{Path: "url-shortener.db"},
+		Postgres:  Postgres{DSN: "postgres://localhost:5432/url_shortener?sslmode=disable", MaxOpenConns: 10},
+		Bolt:      Bolt{Path: "url-shortener.bolt", BackupInterval: time.Hour},
+		Redis:     Redis{URL: "redis://localhost:6379/0", KeyPrefix: "{url-shortener}:"},
+		Cache:     Cache{Size: 10000, TTL: 5 * time.Minute, NegativeTTL: 5 * time.Second},
+		Generator: Generator{Strategy: "hash", Length: 8, NodeID: 0},
+	}, cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server.addr = :9000
+store.backend = memory
+mongo.database = from-file
+generator.strategy = random
+`)
+	t.Setenv("URL_SHORTENER_SERVER_ADDR", ":9001")
+	t.Setenv("URL_SHORTENER_MONGO_DATABASE", "from-env")
+
+	cfg, err := Load([]string{"-config", path, "-server.addr", ":9002", "-generator.length=12"})
+	assert.Nil(t, err)
+	assert.Equal(t, ":9002", cfg.Server.Addr)
+	assert.Equal(t, BackendMemory, cfg.Store.Backend)
+	assert.Equal(t, "from-env", cfg.Mongo.Database)
+	assert.Equal(t, "random", cfg.Generator.Strategy)
+	assert.Equal(t, 12, cfg.Generator.Length)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("URL_SHORTENER_CONFIG", writeFile(t, "store.backend = memory\n"))
+
+	cfg, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, BackendMemory, cfg.Store.Backend)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "Missing File", args: []string{"-config", "/does/not/exist.properties"}},
+		{name: "Unknown Flag", args: []string{"-listen", ":8080"}},
+		{name: "Invalid Address", args: []string{"-server.addr", "8080"}},
+		{name: "Invalid Timeout", args: []string{"-server.read_timeout", "5"}},
+		{name: "Zero Timeout", args: []string{"-server.shutdown_timeout", "0s"}},
+		{name: "Negative Delay", args: []string{"-server.shutdown_delay", "-1s"}},
+		{name: "Unknown Backend", args: []string{"-store.backend", "cassandra"}},
+		{name: "Invalid Mongo URI", args: []string{"-mongo.uri", "localhost:27017"}},
+		{name: "Invalid Mongo Database", args: []string{"-mongo.database", "url.shortner"}},
+		{name: "Zero Mongo Timeout", args: []string{"-mongo.connect_timeout", "0s"}},
+		{name: "No Mongo Connections", args: []string{"-mongo.max_pool_size", "0"}},
+		{name: "Mongo Password Without Username", args: []string{"-mongo.password", "secret"}},
+		{name: "Mongo CA Without TLS", args: []string{"-mongo.tls_ca_file", "ca.pem"}},
+		{name: "No Mongo Ping Attempts", args: []string{"-mongo.ping_attempts", "0"}},
+		{name: "Empty SQLite Path", args: []string{"-store.backend", "sqlite", "-sqlite.path", ""}},
+		{name: "Invalid Postgres DSN", args: []string{"-store.backend", "postgres", "-postgres.dsn", "host=localhost"}},
+		{name: "Zero Bolt Backup Interval", args: []string{"-store.backend", "bolt", "-bolt.backup_path", "backup.bolt", "-bolt.backup_interval", "0s"}},
+		{name: "Bolt Backup Over Itself", args: []string{"-store.backend", "bolt", "-bolt.backup_path", "url-shortener.bolt"}},
+		{name: "No Postgres Connections", args: []string{"-store.backend", "postgres", "-postgres.max_open_conns", "0"}},
+		{name: "Invalid Redis URL", args: []string{"-store.backend", "redis", "-redis.url", "localhost:6379"}},
+		{name: "No Allowed Schemes", args: []string{"-api.allowed_schemes", ""}},
+		{name: "Invalid Allowed Scheme", args: []string{"-api.allowed_schemes", "https;ht tp"}},
+		{name: "Zero Max URL Length", args: []string{"-api.max_url_length", "0"}},
+		{name: "Invalid Blocked Network", args: []string{"-api.blocked_networks", "10.0.0.0/8;10.0.0.0/33"}},
+		{name: "Zero Resolve Timeout", args: []string{"-api.block_private_targets", "true", "-api.resolve_timeout", "0s"}},
+		{name: "Zero Lists Reload Interval", args: []string{"-api.denylist_file", "denylist.txt", "-api.lists_reload_interval", "0s"}},
+		{name: "Negative Cache Size", args: []string{"-cache.size", "-1"}},
+		{name: "Zero Cache TTL", args: []string{"-cache.ttl", "0s"}},
+		{name: "Negative Cache Negative TTL", args: []string{"-cache.negative_ttl", "-1s"}},
+		{name: "Unknown Generator", args: []string{"-generator.strategy", "uuid"}},
+		{name: "Invalid Length", env: map[string]string{"URL_SHORTENER_GENERATOR_LENGTH": "eight"}},
+		{name: "Node Out Of Range", args: []string{"-generator.strategy", "snowflake", "-generator.node_id", "2048"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(tt.args)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestMongoSettingsIgnoredForMemory(t *testing.T) {
+	cfg, err := Load([]string{"-store.backend", "memory", "-mongo.uri", "localhost"})
+	assert.Nil(t, err)
+	assert.Equal(t, BackendMemory, cfg.Store.Backend)
+}
+
+func TestCacheSettingsIgnoredWhenDisabled(t *testing.T) {
+	cfg, err := Load([]string{"-cache.size", "0", "-cache.ttl", "0s"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cfg.Cache.Size)
+}
+
+func TestStripQueryParams(t *testing.T) {
+	cfg, err := Load([]string{"-api.strip_query_params", "ref;utm_*"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ref", "utm_*"}, cfg.API.StripQueryParams)
+
+	cfg, err = Load([]string{"-api.strip_query_params", ""})
+	assert.Nil(t, err)
+	assert.Empty(t, cfg.API.StripQueryParams)
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	cfg, err := Load([]string{"-api.resolve_timeout", "0s"})
+	assert.Nil(t, err)
+	assert.False(t, cfg.API.NetworkPolicy())
+
+	cfg, err = Load([]string{"-api.blocked_hosts", "internal.example.com;corp"})
+	assert.Nil(t, err)
+	assert.True(t, cfg.API.NetworkPolicy())
+	assert.Equal(t, []string{"internal.example.com", "corp"}, cfg.API.BlockedHosts)
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "URL_SHORTENER_GENERATOR_NODE_ID", EnvName("generator.node_id"))
+}
+
+func TestExampleFile(t *testing.T) {
+	cfg, err := Load([]string{"-config", "../url-shortener.properties"})
+	assert.Nil(t, err)
+	defaults, _ := Load(nil)
+	assert.Equal(t, defaults, cfg)
+}
@@ -0,0 +1,447 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the bolt store
+var (
+	// linksBucket maps the url to its link encoded as JSON
+	linksBucket = []byte("links")
+	// shortURLsBucket maps the short url to the url
+	shortURLsBucket = []byte("short_urls")
+	// domainsBucket maps the domain to its counter as a big endian uint64
+	domainsBucket = []byte("domains")
+	// clicksBucket maps short url, 0, timestamp and sequence to the click
+	// encoded as JSON, so that the clicks of a short url are sorted by time
+	clicksBucket = []byte("clicks")
+)
+
+// Bolt keeps the links in an embedded bolt file. Every write happens in a
+// single transaction, the file can be backed up while it is in use.
+type Bolt struct {
+	db *bolt.DB
+	// ctx is done once the store is closed, it stops the background work
+	ctx    context.Context
+	cancel context.CancelFunc
+	// background waits for the janitor and the backups, so that neither
+	// touches the file after Close
+	background sync.WaitGroup
+}
+
+// NewBolt opens the bolt file at path, creating it if needed. Expired links are
+// removed in the background, and the file is copied to backupPath every
+// backupInterval unless backupPath is empty, until the context is done or the
+// store is closed.
+func NewBolt(ctx context.Context, path, backupPath string, backupInterval time.Duration) (interfaces.Store, error) {
+	b, err := newBolt(ctx, path, janitorInterval)
+	if err != nil {
+		return nil, err
+	}
+	if backupPath != "" {
+		b.goBackground(func() { b.backupEvery(b.ctx, backupPath, backupInterval) })
+	}
+	return b, nil
+}
+
+func newBolt(ctx context.Context, path string, interval time.Duration) (*Bolt, error) {
+	// The file is locked by the process using it, opening it twice times out
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, boltError(fmt.Errorf("failed to open %v: %w", path, err))
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{linksBucket, shortURLsBucket, domainsBucket, clicksBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, boltError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	b := &Bolt{db: db, ctx: ctx, cancel: cancel}
+	b.goBackground(func() { janitor(ctx, interval, b.removeExpired) })
+	return b, nil
+}
+
+// goBackground runs f in a goroutine which Close waits for
+func (b *Bolt) goBackground(f func()) {
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		f()
+	}()
+}
+
+// boltError translates a bolt error into one of the errors of the interfaces package.
+func boltError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bolt.ErrDatabaseNotOpen), errors.Is(err, bolt.ErrTimeout):
+		return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	}
+	return err
+}
+
+// getLink decodes the link of the url, it returns nil when there is none
+func getLink(tx *bolt.Tx, url []byte) (*models.UrlCollection, error) {
+	v := tx.Bucket(linksBucket).Get(url)
+	if v == nil {
+		return nil, nil
+	}
+	link := &models.UrlCollection{}
+	if err := json.Unmarshal(v, link); err != nil {
+		return nil, fmt.Errorf("invalid link of %s: %v", url, err)
+	}
+	return link, nil
+}
+
+// deleteLink removes the link from the links and short urls buckets
+func deleteLink(tx *bolt.Tx, link *models.UrlCollection) error {
+	if err := tx.Bucket(linksBucket).Delete([]byte(link.URL)); err != nil {
+		return err
+	}
+	return tx.Bucket(shortURLsBucket).Delete([]byte(link.ShortURL))
+}
+
+// removeExpired deletes the links which expired at now and returns how many were deleted
+func (b *Bolt) removeExpired(now time.Time) (int, error) {
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var expired []*models.UrlCollection
+		err := tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+			link := &models.UrlCollection{}
+			if err := json.Unmarshal(v, link); err != nil {
+				return fmt.Errorf("invalid link of %s: %v", k, err)
+			}
+			if link.Expired(now) {
+				expired = append(expired, link)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// The bucket must not be modified while iterating over it
+		for _, link := range expired {
+			if err := deleteLink(tx, link); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	return removed, boltError(err)
+}
+
+// Create stores the link in both buckets and increments the counter of its
+// domain in a single write transaction. Expired links with the same url or
+// short url are replaced.
+func (b *Bolt) Create(ctx context.Context, link *models.UrlCollection) error {
+	if link.URL == "" || link.ShortURL == "" {
+		return fmt.Errorf("%w: url and short url are required", interfaces.ErrInvalidArgument)
+	}
+
+	link.Domain = utils.GetDomain(link.URL)
+	encoded, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		existing, err := getLink(tx, []byte(link.URL))
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if !existing.Expired(now) {
+				return fmt.Errorf("%w: %v", interfaces.ErrConflict, link.URL)
+			}
+			if err := deleteLink(tx, existing); err != nil {
+				return err
+			}
+		}
+
+		if url := tx.Bucket(shortURLsBucket).Get([]byte(link.ShortURL)); url != nil {
+			existing, err := getLink(tx, url)
+			if err != nil {
+				return err
+			}
+			if existing != nil && !existing.Expired(now) {
+				return fmt.Errorf("%w: %v", interfaces.ErrShortURLConflict, link.ShortURL)
+			}
+			if existing != nil {
+				if err := deleteLink(tx, existing); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Bucket(linksBucket).Put([]byte(link.URL), encoded); err != nil {
+			return err
+		}
+		if err := tx.Bucket(shortURLsBucket).Put([]byte(link.ShortURL), []byte(link.URL)); err != nil {
+			return err
+		}
+
+		domains := tx.Bucket(domainsBucket)
+		counter := make([]byte, 8)
+		if v := domains.Get([]byte(link.Domain)); v != nil {
+			binary.BigEndian.PutUint64(counter, binary.BigEndian.Uint64(v)+1)
+		} else {
+			binary.BigEndian.PutUint64(counter, 1)
+		}
+		return domains.Put([]byte(link.Domain), counter)
+	})
+	if err != nil {
+		log.Printf("Error while inserting the value for %v. %v", link.URL, err)
+		return boltError(err)
+	}
+	return nil
+}
+
+func (b *Bolt) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%w: url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	var link *models.UrlCollection
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		link, err = getLink(tx, []byte(url))
+		return err
+	})
+	if err != nil {
+		return nil, boltError(err)
+	}
+	if link == nil {
+		log.Printf("Could not find %v in the database", url)
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrNotFound, url)
+	}
+	return link, nil
+}
+
+func (b *Bolt) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	if shortURL == "" {
+		return nil, fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	var link *models.UrlCollection
+	err := b.db.View(func(tx *bolt.Tx) error {
+		url := tx.Bucket(shortURLsBucket).Get([]byte(shortURL))
+		if url == nil {
+			return nil
+		}
+		var err error
+		link, err = getLink(tx, url)
+		return err
+	})
+	if err != nil {
+		return nil, boltError(err)
+	}
+	if link == nil {
+		log.Printf("Error while finding %v in the database", shortURL)
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrNotFound, shortURL)
+	}
+	return link, nil
+}
+
+// GetTopDomains reads the counters, or counts the links created in the window
+// of the query per domain
+func (b *Bolt) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	if query.Limit < 1 || query.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", interfaces.ErrInvalidArgument)
+	}
+
+	counters := make(map[string]int)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if !query.Windowed() {
+			return tx.Bucket(domainsBucket).ForEach(func(k, v []byte) error {
+				counters[string(k)] = int(binary.BigEndian.Uint64(v))
+				return nil
+			})
+		}
+		return tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+			link := &models.UrlCollection{}
+			if err := json.Unmarshal(v, link); err != nil {
+				return fmt.Errorf("invalid link of %s: %v", k, err)
+			}
+			if !query.Since.IsZero() && link.CreatedAt.Before(query.Since) {
+				return nil
+			}
+			if !query.Until.IsZero() && !link.CreatedAt.Before(query.Until) {
+				return nil
+			}
+			counters[link.Domain]++
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("Error getting details from the database. %v", err)
+		return nil, boltError(err)
+	}
+	return topDomains(counters, query), nil
+}
+
+// clickKey returns the key of the click of the short url at ts, the sequence
+// keeps clicks at the same time apart
+func clickKey(shortURL string, ts time.Time, seq uint64) []byte {
+	key := make([]byte, 0, len(shortURL)+17)
+	key = append(key, shortURL...)
+	key = append(key, 0)
+	key = binary.BigEndian.AppendUint64(key, uint64(ts.UnixNano()))
+	return binary.BigEndian.AppendUint64(key, seq)
+}
+
+func (b *Bolt) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	if click.ShortURL == "" {
+		return fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	encoded, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		clicks := tx.Bucket(clicksBucket)
+		seq, err := clicks.NextSequence()
+		if err != nil {
+			return err
+		}
+		return clicks.Put(clickKey(click.ShortURL, click.Timestamp, seq), encoded)
+	})
+	if err != nil {
+		log.Printf("Error while inserting the click for %v. %v", click.ShortURL, err)
+		return boltError(err)
+	}
+	return nil
+}
+
+// GetClickStats counts the clicks of the short url in buckets starting at query.Since
+func (b *Bolt) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	if query.ShortURL == "" || query.Interval <= 0 {
+		return nil, fmt.Errorf("%w: short url and interval are required", interfaces.ErrInvalidArgument)
+	}
+
+	stats := &models.ClickStats{}
+	prefix := append([]byte(query.ShortURL), 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(clicksBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			stats.Total++
+		}
+
+		// The keys are sorted by time, so the window is a range of keys
+		until := clickKey(query.ShortURL, query.Until, 0)
+		for k, _ := c.Seek(clickKey(query.ShortURL, query.Since, 0)); k != nil && bytes.Compare(k, until) < 0; k, _ = c.Next() {
+			ts := time.Unix(0, int64(binary.BigEndian.Uint64(k[len(prefix):])))
+			start := query.Since.Add(ts.Sub(query.Since) / query.Interval * query.Interval)
+			if n := len(stats.Buckets); n > 0 && stats.Buckets[n-1].Start.Equal(start) {
+				stats.Buckets[n-1].Count++
+				continue
+			}
+			stats.Buckets = append(stats.Buckets, models.ClickBucket{Start: start, Count: 1})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error while aggregating the clicks of %v. %v", query.ShortURL, err)
+		return nil, boltError(err)
+	}
+	return stats, nil
+}
+
+// Backup writes a consistent copy of the database to w. Writes can continue
+// while the copy is made.
+func (b *Bolt) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, boltError(err)
+}
+
+// BackupFile copies the database to path. The copy is written next to path and
+// renamed once complete, so that path always holds a complete backup.
+func (b *Bolt) BackupFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := b.Backup(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// backupEvery copies the database to path on every tick until the context is done
+func (b *Bolt) backupEvery(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.BackupFile(path); err != nil {
+				log.Printf("Failed to back up the database to %v. %v", path, err)
+				continue
+			}
+			log.Printf("Backed up the database to %v", path)
+		}
+	}
+}
+
+// Ping checks that the file is still open
+func (b *Bolt) Ping(ctx context.Context) error {
+	return boltError(b.db.View(func(tx *bolt.Tx) error { return nil }))
+}
+
+// Close stops the background work and closes the file, waiting for the
+// transactions in progress
+func (b *Bolt) Close(ctx context.Context) error {
+	b.cancel()
+	b.background.Wait()
+	if err := b.db.Close(); err != nil {
+		log.Printf("Error while closing the database. %v", err)
+		return boltError(err)
+	}
+	return nil
+}
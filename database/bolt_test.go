@@ -0,0 +1,113 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBolt(t *testing.T) *Bolt {
+	b, err := newBolt(context.Background(), filepath.Join(t.TempDir(), "test.bolt"), janitorInterval)
+	if err != nil {
+		t.Fatalf("failed to open bolt: %v", err)
+	}
+	t.Cleanup(func() { b.Close(context.Background()) })
+	return b
+}
+
+func TestBolt_Store(t *testing.T) {
+	testStore(t, func(t *testing.T) interfaces.Store { return newTestBolt(t) })
+}
+
+func TestBolt_Janitor(t *testing.T) {
+	testStore, err := newBolt(context.Background(), filepath.Join(t.TempDir(), "test.bolt"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to open bolt: %v", err)
+	}
+	defer testStore.Close(context.Background())
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf"}))
+
+	assert.Eventually(t, func() bool {
+		_, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+		return errors.Is(err, interfaces.ErrNotFound)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = testStore.GetByURL(context.Background(), "https://www.youtube.com")
+	assert.Nil(t, err)
+}
+
+func TestBolt_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bolt")
+	testStore, err := NewBolt(context.Background(), path, "", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}))
+
+	// The file is locked while the store is open
+	_, err = newBolt(context.Background(), path, janitorInterval)
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	assert.Nil(t, testStore.Close(context.Background()))
+	assert.ErrorIs(t, testStore.Ping(context.Background()), interfaces.ErrUnavailable)
+
+	testStore, err = NewBolt(context.Background(), path, "", 0)
+	assert.Nil(t, err)
+	defer testStore.Close(context.Background())
+	assert.Nil(t, testStore.Ping(context.Background()))
+
+	val, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.google.com", val.URL)
+}
+
+func TestBolt_Backup(t *testing.T) {
+	dir := t.TempDir()
+	testStore := newTestBolt(t)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}))
+
+	t.Run("Backup To Writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := testStore.Backup(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(buf.Len()), n)
+	})
+
+	t.Run("Backup To File", func(t *testing.T) {
+		path := filepath.Join(dir, "backup.bolt")
+		assert.Nil(t, testStore.BackupFile(path))
+		// The store stays writable after the backup
+		assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf"}))
+
+		backup, err := newBolt(context.Background(), path, janitorInterval)
+		assert.Nil(t, err)
+		defer backup.Close(context.Background())
+		_, err = backup.GetByShortURL(context.Background(), "google.com/7378mDnD")
+		assert.Nil(t, err)
+		_, err = backup.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Periodic Backup", func(t *testing.T) {
+		path := filepath.Join(dir, "periodic.bolt")
+		periodic, err := NewBolt(context.Background(), filepath.Join(dir, "periodic-src.bolt"), path, 10*time.Millisecond)
+		assert.Nil(t, err)
+		defer periodic.Close(context.Background())
+
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(path)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/monitoring"
+)
+
+// CachedStore keeps the links read from the wrapped store in a bounded LRU.
+// Lookups of links which do not exist are cached as well, for negativeTTL, so
+// that unknown codes do not reach the store on every request. The entries of
+// a link are invalidated when it is created through the cache. Creations on
+// other replicas are only seen once the entries have expired.
+type CachedStore struct {
+	interfaces.Store
+	cache       *lru
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// NewCachedStore wraps the store with a cache of at most size links, kept for
+// ttl. Links which are not found are kept for negativeTTL, or not at all when
+// it is zero.
+func NewCachedStore(store interfaces.Store, size int, ttl, negativeTTL time.Duration) interfaces.Store {
+	return &CachedStore{Store: store, cache: newLRU(size), ttl: ttl, negativeTTL: negativeTTL}
+}
+
+// Keys of the cache, the same link is cached under both
+func urlKey(url string) string           { return "url:" + url }
+func shortURLKey(shortURL string) string { return "short:" + shortURL }
+
+// get returns the cached link of key or loads it from the store
+func (s *CachedStore) get(operation, key string, load func() (*models.UrlCollection, error)) (*models.UrlCollection, error) {
+	now := time.Now()
+	if link, found, ok := s.cache.get(key, now); ok {
+		if !found {
+			monitoring.CacheLookups.WithLabelValues(operation, "negative_hit").Inc()
+			return nil, interfaces.ErrNotFound
+		}
+		monitoring.CacheLookups.WithLabelValues(operation, "hit").Inc()
+		copied := *link
+		return &copied, nil
+	}
+	monitoring.CacheLookups.WithLabelValues(operation, "miss").Inc()
+
+	// A link created while loading invalidates the cache, the loaded value is
+	// then not added as it may already be stale
+	gen := s.cache.generation()
+	link, err := load()
+	switch {
+	case err == nil:
+		// The link is not served past its own expiry
+		expires := now.Add(s.ttl)
+		if link.ExpiresAt != nil && link.ExpiresAt.Before(expires) {
+			expires = *link.ExpiresAt
+		}
+		copied := *link
+		s.cache.add(key, &copied, expires, gen)
+	case errors.Is(err, interfaces.ErrNotFound) && s.negativeTTL > 0:
+		s.cache.add(key, nil, now.Add(s.negativeTTL), gen)
+	}
+	return link, err
+}
+
+func (s *CachedStore) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	return s.get("get_by_url", urlKey(url), func() (*models.UrlCollection, error) {
+		return s.Store.GetByURL(ctx, url)
+	})
+}
+
+func (s *CachedStore) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	return s.get("get_by_short_url", shortURLKey(shortURL), func() (*models.UrlCollection, error) {
+		return s.Store.GetByShortURL(ctx, shortURL)
+	})
+}
+
+// Create removes the entries of the url and the short url, which may hold
+// that they do not exist or a link which has expired and was replaced. The
+// replaced link is also dropped from the entry of its other key.
+func (s *CachedStore) Create(ctx context.Context, link *models.UrlCollection) error {
+	err := s.Store.Create(ctx, link)
+	s.cache.removeLinks(urlKey(link.URL), shortURLKey(link.ShortURL))
+	return err
+}
+
+// lru is a cache of links which evicts the least recently used entry once it
+// holds size entries. A nil link records that the key was not found.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+	gen   uint64
+}
+
+type lruEntry struct {
+	key     string
+	link    *models.UrlCollection
+	expires time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the link of key, found is false for a negative entry and ok is
+// false when the key is not cached or its entry has expired
+func (c *lru) get(key string, now time.Time) (link *models.UrlCollection, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !now.Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.link, entry.link != nil, true
+}
+
+// generation returns a value which changes whenever entries are removed
+func (c *lru) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add caches the link of key unless entries were removed since gen was read
+func (c *lru) add(key string, link *models.UrlCollection, expires time.Time, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen || c.size <= 0 {
+		return
+	}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = &lruEntry{key: key, link: link, expires: expires}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, link: link, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+		monitoring.CacheEvictions.Inc()
+	}
+}
+
+// remove drops the entries of the keys
+func (c *lru) remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, key := range keys {
+		c.removeKey(key)
+	}
+}
+
+// removeLinks drops the entries of the keys and of the links they hold, even
+// expired ones, under both their keys
+func (c *lru) removeLinks(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, key := range keys {
+		if link := c.removeKey(key); link != nil {
+			c.removeKey(urlKey(link.URL))
+			c.removeKey(shortURLKey(link.ShortURL))
+		}
+	}
+}
+
+// removeKey drops the entry of key and returns its link, c.mu must be held
+func (c *lru) removeKey(key string) *models.UrlCollection {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	c.order.Remove(elem)
+	delete(c.items, key)
+	return elem.Value.(*lruEntry).link
+}
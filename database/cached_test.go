@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	mocks "url-shortener/mocks/interfaces"
+	"url-shortener/models"
+	"url-shortener/monitoring"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCachedStore_GetByShortURL(t *testing.T) {
+	link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}
+
+	t.Run("Hit", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(link, nil).Once()
+		cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+		hits := monitoring.CacheLookups.WithLabelValues("get_by_short_url", "hit").Value()
+
+		for i := 0; i < 3; i++ {
+			val, err := cached.GetByShortURL(context.Background(), link.ShortURL)
+			assert.Nil(t, err)
+			assert.Equal(t, link, val)
+		}
+		assert.Equal(t, hits+2, monitoring.CacheLookups.WithLabelValues("get_by_short_url", "hit").Value())
+	})
+	t.Run("Negative Hit", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, "youtube.com/46O6pjZf").Return(nil, interfaces.ErrNotFound).Once()
+		cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			_, err := cached.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+			assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		}
+	})
+	t.Run("Negative Caching Disabled", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, "youtube.com/46O6pjZf").Return(nil, interfaces.ErrNotFound).Twice()
+		cached := NewCachedStore(testStore, 10, time.Minute, 0)
+
+		for i := 0; i < 2; i++ {
+			_, err := cached.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+			assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		}
+	})
+	t.Run("Errors Are Not Cached", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(nil, interfaces.ErrUnavailable).Once()
+		testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(link, nil).Once()
+		cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+		_, err := cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+		val, err := cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+	})
+	t.Run("Expired Entry", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(link, nil).Twice()
+		cached := NewCachedStore(testStore, 10, time.Millisecond, time.Minute)
+
+		_, err := cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.Nil(t, err)
+		time.Sleep(2 * time.Millisecond)
+		_, err = cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.Nil(t, err)
+	})
+	t.Run("Returned Links Are Copies", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(&models.UrlCollection{URL: link.URL, ShortURL: link.ShortURL}, nil).Once()
+		cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+		val, _ := cached.GetByShortURL(context.Background(), link.ShortURL)
+		val.URL = "https://www.youtube.com"
+		val, _ = cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.Equal(t, link.URL, val.URL)
+	})
+}
+
+func TestCachedStore_Create(t *testing.T) {
+	link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}
+	testStore := mocks.NewStore(t)
+	testStore.On("GetByURL", mock.Anything, link.URL).Return(nil, interfaces.ErrNotFound).Once()
+	testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(nil, interfaces.ErrNotFound).Once()
+	testStore.On("Create", mock.Anything, link).Return(nil).Once()
+	testStore.On("GetByURL", mock.Anything, link.URL).Return(link, nil).Once()
+	testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(link, nil).Once()
+	cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+	_, err := cached.GetByURL(context.Background(), link.URL)
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	_, err = cached.GetByShortURL(context.Background(), link.ShortURL)
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+	// The negative entries are dropped by the creation
+	assert.Nil(t, cached.Create(context.Background(), link))
+	for i := 0; i < 2; i++ {
+		val, err := cached.GetByURL(context.Background(), link.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+		val, err = cached.GetByShortURL(context.Background(), link.ShortURL)
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+	}
+}
+
+func TestCachedStore_LinkExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}
+	testStore := mocks.NewStore(t)
+	testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(link, nil).Once()
+	testStore.On("GetByShortURL", mock.Anything, link.ShortURL).Return(nil, interfaces.ErrNotFound).Once()
+	cached := NewCachedStore(testStore, 10, time.Minute, 0)
+
+	_, err := cached.GetByShortURL(context.Background(), link.ShortURL)
+	assert.Nil(t, err)
+	// The entry expires with the link rather than after the ttl
+	time.Sleep(30 * time.Millisecond)
+	_, err = cached.GetByShortURL(context.Background(), link.ShortURL)
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+}
+
+func TestCachedStore_CreateReplacesLink(t *testing.T) {
+	old := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}
+	link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/Hb6Vw0Ke"}
+	testStore := mocks.NewStore(t)
+	testStore.On("GetByURL", mock.Anything, old.URL).Return(old, nil).Once()
+	testStore.On("GetByShortURL", mock.Anything, old.ShortURL).Return(old, nil).Once()
+	testStore.On("Create", mock.Anything, link).Return(nil).Once()
+	testStore.On("GetByShortURL", mock.Anything, old.ShortURL).Return(nil, interfaces.ErrNotFound).Once()
+	cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+	_, err := cached.GetByURL(context.Background(), old.URL)
+	assert.Nil(t, err)
+	_, err = cached.GetByShortURL(context.Background(), old.ShortURL)
+	assert.Nil(t, err)
+
+	// The old link was replaced, its short url is not served from the cache
+	assert.Nil(t, cached.Create(context.Background(), link))
+	_, err = cached.GetByShortURL(context.Background(), old.ShortURL)
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+}
+
+func TestCachedStore_Passthrough(t *testing.T) {
+	testStore := mocks.NewStore(t)
+	testStore.On("Ping", mock.Anything).Return(nil).Once()
+	testStore.On("Close", mock.Anything).Return(nil).Once()
+	cached := NewCachedStore(testStore, 10, time.Minute, time.Minute)
+
+	assert.Nil(t, cached.Ping(context.Background()))
+	assert.Nil(t, cached.Close(context.Background()))
+}
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	cache := newLRU(2)
+	for i := 0; i < 2; i++ {
+		cache.add(fmt.Sprint(i), &models.UrlCollection{ShortURL: fmt.Sprint(i)}, now.Add(time.Minute), 0)
+	}
+
+	t.Run("Evicts The Least Recently Used", func(t *testing.T) {
+		_, _, ok := cache.get("0", now)
+		assert.True(t, ok)
+		cache.add("2", &models.UrlCollection{ShortURL: "2"}, now.Add(time.Minute), 0)
+
+		_, _, ok = cache.get("1", now)
+		assert.False(t, ok)
+		link, found, ok := cache.get("0", now)
+		assert.True(t, ok)
+		assert.True(t, found)
+		assert.Equal(t, "0", link.ShortURL)
+	})
+	t.Run("Negative Entry", func(t *testing.T) {
+		cache.add("3", nil, now.Add(time.Minute), 0)
+		_, found, ok := cache.get("3", now)
+		assert.True(t, ok)
+		assert.False(t, found)
+	})
+	t.Run("Stale Generation Is Not Added", func(t *testing.T) {
+		gen := cache.generation()
+		cache.remove("3")
+		cache.add("3", &models.UrlCollection{ShortURL: "3"}, now.Add(time.Minute), gen)
+		_, _, ok := cache.get("3", now)
+		assert.False(t, ok)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		_, _, ok := cache.get("0", now.Add(time.Minute))
+		assert.False(t, ok)
+		assert.NotContains(t, cache.items, "0")
+	})
+}
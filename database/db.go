@@ -1,98 +1,453 @@
 package database
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
 	"log"
 	"sort"
+	"sync"
+	"time"
 	"url-shortener/interfaces"
 	"url-shortener/models"
 	"url-shortener/utils"
 )
 
-// DB struct contains the url,ShortURL map and metrics map data types
+// DB struct contains the links and the short url index in shards, the
+// metrics map and the clicks per short url
 type DB struct {
-	urlMap     map[string]string
+	shards [shardCount]shard
+
+	metricsMu  sync.Mutex
 	metricsMap map[string]int
+
+	clicksMu  sync.RWMutex
+	clicksMap map[string]*clickHistory
+
+	cancel context.CancelFunc
+}
+
+// shard holds the links whose url hashes to it and the index entries whose
+// short url hashes to it. Shards which are locked together are always locked
+// in the order of their index.
+type shard struct {
+	mu sync.RWMutex
+	// urlMap maps the url to its link
+	urlMap map[string]models.UrlCollection
+	// shortMap maps the short url to the url of its link
+	shortMap map[string]string
+}
+
+const shardCount = 32
+
+// maxClickHistory is the number of clicks kept per short url, older clicks
+// only count towards the total
+const maxClickHistory = 10000
+
+// clickHistory holds the newest clicks of a short url in a ring, and the
+// number of clicks since the link was created
+type clickHistory struct {
+	total int
+	times []time.Time
+	// next is the index of the oldest click once the ring is full
+	next int
 }
 
-// NewStore returns an entry of the Store interface
-func NewStore() interfaces.Store {
+// add records the click, replacing the oldest one once the ring is full
+func (h *clickHistory) add(ts time.Time) {
+	h.total++
+	if len(h.times) < maxClickHistory {
+		h.times = append(h.times, ts)
+		return
+	}
+	h.times[h.next] = ts
+	h.next = (h.next + 1) % maxClickHistory
+}
+
+// janitorInterval is how often expired links are removed from the maps
+const janitorInterval = time.Minute
+
+// NewStore returns an entry of the Store interface. Expired links are removed
+// in the background until the context is done or the store is closed.
+func NewStore(ctx context.Context) interfaces.Store {
+	return newDB(ctx, janitorInterval)
+}
+
+func newDB(ctx context.Context, interval time.Duration) *DB {
+	ctx, cancel := context.WithCancel(ctx)
 	db := &DB{
-		urlMap:     make(map[string]string),
 		metricsMap: make(map[string]int),
+		clicksMap:  make(map[string]*clickHistory),
+		cancel:     cancel,
+	}
+	for i := range db.shards {
+		db.shards[i].urlMap = make(map[string]models.UrlCollection)
+		db.shards[i].shortMap = make(map[string]string)
 	}
+	go janitor(ctx, interval, func(now time.Time) (int, error) {
+		return db.removeExpired(now), nil
+	})
 	return db
 }
 
-// Create this function is used to add the entry in the maps for url and shortURl
-// and also adds the entry for the metric in the metrics map
-func (db *DB) Create(url, shortURl string) bool {
-	domain := utils.GetDomain(url)
-	db.urlMap[url] = shortURl
+// shardOf returns the index of the shard of the key, using FNV-1a
+func shardOf(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % shardCount)
+}
+
+// lock write locks the shards in the order of their index and returns the
+// function unlocking them
+func (db *DB) lock(indexes ...int) func() {
+	var locked [shardCount]bool
+	for _, i := range indexes {
+		locked[i] = true
+	}
+	for i := range locked {
+		if locked[i] {
+			db.shards[i].mu.Lock()
+		}
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			if locked[i] {
+				db.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
 
-	if db.metricsMap[domain] != 0 {
-		value := db.metricsMap[domain] + 1
-		db.metricsMap[domain] = value
-	} else {
-		db.metricsMap[domain] = 1
+// lockLink locks every shard the creation of a link may change: the shards of
+// its url and short url, the shard of the short url of the existing link of
+// the url and the shard of the url already holding the short url. The last
+// two are only known once the first are locked, so the locks are taken again
+// until they cover them.
+func (db *DB) lockLink(url, shortURL string) func() {
+	locked := []int{shardOf(url), shardOf(shortURL)}
+	for {
+		unlock := db.lock(locked...)
+		needed := append([]int(nil), locked...)
+		if v, ok := db.shards[shardOf(url)].urlMap[url]; ok {
+			needed = append(needed, shardOf(v.ShortURL))
+		}
+		if other, ok := db.shards[shardOf(shortURL)].shortMap[shortURL]; ok {
+			needed = append(needed, shardOf(other))
+		}
+		if covers(locked, needed) {
+			return unlock
+		}
+		unlock()
+		locked = needed
 	}
+}
 
+// covers reports whether every index of needed is in locked
+func covers(locked, needed []int) bool {
+	for _, n := range needed {
+		found := false
+		for _, l := range locked {
+			found = found || l == n
+		}
+		if !found {
+			return false
+		}
+	}
 	return true
 }
 
+// Ping always succeeds as the entries are held in memory
+func (db *DB) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close stops the janitor, the entries stay readable
+func (db *DB) Close(ctx context.Context) error {
+	if db.cancel != nil {
+		db.cancel()
+	}
+	return nil
+}
+
+// janitor calls removeExpired on every tick until the context is done, it is
+// used by the stores which do not expire the links by themselves
+func janitor(ctx context.Context, interval time.Duration, removeExpired func(now time.Time) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			removed, err := removeExpired(now)
+			if err != nil {
+				log.Printf("Failed to remove the expired links. %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d expired links", removed)
+			}
+		}
+	}
+}
+
+// removeExpired deletes the links which expired at now and returns how many
+// were deleted. The expired links of a shard are collected under its read
+// lock, then every link is removed together with its index entry.
+func (db *DB) removeExpired(now time.Time) int {
+	removed := 0
+	for i := range db.shards {
+		var expired []models.UrlCollection
+		db.shards[i].mu.RLock()
+		for _, v := range db.shards[i].urlMap {
+			if v.Expired(now) {
+				expired = append(expired, v)
+			}
+		}
+		db.shards[i].mu.RUnlock()
+
+		for _, v := range expired {
+			unlock := db.lock(shardOf(v.URL), shardOf(v.ShortURL))
+			// The link may have been replaced since it was collected
+			if current, ok := db.shards[i].urlMap[v.URL]; ok && current.ShortURL == v.ShortURL && current.Expired(now) {
+				db.deleteLink(current)
+				removed++
+			}
+			unlock()
+		}
+	}
+	return removed
+}
+
+// deleteLink removes the link, its index entry and its clicks, the shards of
+// both must be locked
+func (db *DB) deleteLink(link models.UrlCollection) {
+	delete(db.shards[shardOf(link.URL)].urlMap, link.URL)
+	delete(db.shards[shardOf(link.ShortURL)].shortMap, link.ShortURL)
+	db.clicksMu.Lock()
+	delete(db.clicksMap, link.ShortURL)
+	db.clicksMu.Unlock()
+}
+
+// Create this function is used to add the entry in the maps for url and shortURl
+// and also adds the entry for the metric in the metrics map. Expired entries
+// for the same url or shortURL are replaced.
+func (db *DB) Create(ctx context.Context, link *models.UrlCollection) error {
+	if link.URL == "" || link.ShortURL == "" {
+		return fmt.Errorf("%w: url and short url are required", interfaces.ErrInvalidArgument)
+	}
+
+	// The checks and the insert happen under the locks of all the shards
+	// involved, so that two concurrent creations cannot claim the same url or
+	// short url
+	unlock := db.lockLink(link.URL, link.ShortURL)
+	defer unlock()
+	now := time.Now()
+	urlShard, shortShard := &db.shards[shardOf(link.URL)], &db.shards[shardOf(link.ShortURL)]
+
+	existing, found := urlShard.urlMap[link.URL]
+	if found && !existing.Expired(now) {
+		return fmt.Errorf("%w: %v", interfaces.ErrConflict, link.URL)
+	}
+	var taken models.UrlCollection
+	if other, ok := shortShard.shortMap[link.ShortURL]; ok && other != link.URL {
+		taken = db.shards[shardOf(other)].urlMap[other]
+		if !taken.Expired(now) {
+			return fmt.Errorf("%w: %v", interfaces.ErrShortURLConflict, link.ShortURL)
+		}
+	}
+
+	if found {
+		db.deleteLink(existing)
+	}
+	if taken.URL != "" {
+		db.deleteLink(taken)
+	}
+	domain := utils.GetDomain(link.URL)
+	link.Domain = domain
+	urlShard.urlMap[link.URL] = *link
+	shortShard.shortMap[link.ShortURL] = link.URL
+
+	db.metricsMu.Lock()
+	db.metricsMap[domain]++
+	db.metricsMu.Unlock()
+	return nil
+}
+
 // GetByURL this function is used to get the value of the shortURL w.r.t to the URL
-func (db *DB) GetByURL(url string) string {
+func (db *DB) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
 	if len(url) < 1 {
 		log.Println("Url can not be empty!")
-		return ""
+		return nil, fmt.Errorf("%w: url is empty", interfaces.ErrInvalidArgument)
 	}
 
-	if db.urlMap[url] != "" {
-		fmt.Println("Entry Already Present", db.urlMap[url])
+	s := &db.shards[shardOf(url)]
+	s.mu.RLock()
+	link, ok := s.urlMap[url]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrNotFound, url)
 	}
-
-	return db.urlMap[url]
+	return &link, nil
 }
 
 // GetByShortURL this function is used to get the value of the url w.r.t to the ShortURL
-func (db *DB) GetByShortURL(shortUrl string) (url string) {
-	if len(shortUrl) < 1 {
+// using the short url index
+func (db *DB) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	if len(shortURL) < 1 {
 		log.Println("Short url not found!")
-		return ""
+		return nil, fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
 	}
 
-	for k, v := range db.urlMap {
-		if v == shortUrl {
-			url = k
-		}
+	s := &db.shards[shardOf(shortURL)]
+	s.mu.RLock()
+	url, ok := s.shortMap[shortURL]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrNotFound, shortURL)
 	}
-	return url
+
+	s = &db.shards[shardOf(url)]
+	s.mu.RLock()
+	link, ok := s.urlMap[url]
+	s.mu.RUnlock()
+	// The link may have been replaced between both lookups
+	if !ok || link.ShortURL != shortURL {
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrNotFound, shortURL)
+	}
+	return &link, nil
 }
 
-// GetTopThreeDomains lists down the top three most hit domains
-func (db *DB) GetTopThreeDomains() []models.DomainMetricsCollection {
-	keys := make([]string, 0, len(db.metricsMap))
-	for k := range db.metricsMap {
-		keys = append(keys, k)
+// GetTopDomains lists down the most hit domains of the query
+func (db *DB) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	if query.Limit < 1 || query.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", interfaces.ErrInvalidArgument)
 	}
 
-	sort.SliceStable(keys, func(i, j int) bool {
-		return db.metricsMap[keys[i]] > db.metricsMap[keys[j]]
-	})
+	if !query.Windowed() {
+		db.metricsMu.Lock()
+		defer db.metricsMu.Unlock()
+		return topDomains(db.metricsMap, query), nil
+	}
 
-	var dmc []models.DomainMetricsCollection
-	i := 0
-	for _, k := range keys {
-		if len(keys) > 0 && len(keys) <= 3 {
-			dmc = append(dmc, models.DomainMetricsCollection{Domain: k, Counter: db.metricsMap[k]})
-		}
-		if len(keys) > 3 {
-			if i == 3 {
-				return dmc
+	counters := make(map[string]int)
+	for i := range db.shards {
+		db.shards[i].mu.RLock()
+		for _, v := range db.shards[i].urlMap {
+			if !query.Since.IsZero() && v.CreatedAt.Before(query.Since) {
+				continue
+			}
+			if !query.Until.IsZero() && !v.CreatedAt.Before(query.Until) {
+				continue
 			}
-			dmc = append(dmc, models.DomainMetricsCollection{Domain: k, Counter: db.metricsMap[k]})
-			i++
+			counters[v.Domain]++
+		}
+		db.shards[i].mu.RUnlock()
+	}
+	return topDomains(counters, query), nil
+}
+
+// topDomains returns the page of the query of the counters ordered by
+// counter and name. Only the offset+limit largest counters are kept in a heap.
+func topDomains(counters map[string]int, query *models.DomainMetricsQuery) []models.DomainMetricsCollection {
+	size := query.Offset + query.Limit
+	h := &domainHeap{}
+	for domain, counter := range counters {
+		dm := models.DomainMetricsCollection{Domain: domain, Counter: counter}
+		if h.Len() < size {
+			heap.Push(h, dm)
+		} else if h.less(h.items[0], dm) {
+			h.items[0] = dm
+			heap.Fix(h, 0)
 		}
 	}
-	return dmc
+
+	// Popping the min heap returns the domains from the smallest to the largest counter
+	sorted := make([]models.DomainMetricsCollection, h.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(h).(models.DomainMetricsCollection)
+	}
+	if query.Offset >= len(sorted) {
+		return nil
+	}
+	return sorted[query.Offset:]
+}
+
+// domainHeap is a min heap of domain metrics, the root being the domain which
+// ranks last
+type domainHeap struct {
+	items []models.DomainMetricsCollection
+}
+
+// less reports whether a ranks after b, i.e. it has a smaller counter or the
+// same counter and a larger name
+func (h *domainHeap) less(a, b models.DomainMetricsCollection) bool {
+	if a.Counter != b.Counter {
+		return a.Counter < b.Counter
+	}
+	return a.Domain > b.Domain
+}
+
+func (h *domainHeap) Len() int           { return len(h.items) }
+func (h *domainHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *domainHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *domainHeap) Push(x any)         { h.items = append(h.items, x.(models.DomainMetricsCollection)) }
+func (h *domainHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// RecordClick adds the time of the click to the clicks of the short url. The
+// referrer and user agent are not kept by the in memory store, and only the
+// newest maxClickHistory clicks are counted in the buckets of the stats.
+func (db *DB) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	if click.ShortURL == "" {
+		return fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	db.clicksMu.Lock()
+	defer db.clicksMu.Unlock()
+	history, ok := db.clicksMap[click.ShortURL]
+	if !ok {
+		history = &clickHistory{}
+		db.clicksMap[click.ShortURL] = history
+	}
+	history.add(click.Timestamp)
+	return nil
+}
+
+// GetClickStats counts the clicks of the short url in buckets starting at query.Since
+func (db *DB) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	if query.ShortURL == "" || query.Interval <= 0 {
+		return nil, fmt.Errorf("%w: short url and interval are required", interfaces.ErrInvalidArgument)
+	}
+
+	db.clicksMu.RLock()
+	defer db.clicksMu.RUnlock()
+
+	history := db.clicksMap[query.ShortURL]
+	if history == nil {
+		history = &clickHistory{}
+	}
+	counts := make(map[time.Time]int)
+	for _, ts := range history.times {
+		if ts.Before(query.Since) || !ts.Before(query.Until) {
+			continue
+		}
+		start := query.Since.Add(ts.Sub(query.Since) / query.Interval * query.Interval)
+		counts[start]++
+	}
+
+	stats := &models.ClickStats{Total: history.total}
+	for start, count := range counts {
+		stats.Buckets = append(stats.Buckets, models.ClickBucket{Start: start, Count: count})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Start.Before(stats.Buckets[j].Start)
+	})
+	return stats, nil
 }
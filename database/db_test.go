@@ -1,65 +1,68 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
+	"url-shortener/interfaces"
 	"url-shortener/models"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCreateDB(t *testing.T) {
-	testStore := NewStore()
-	t.Run("Create Success", func(t *testing.T) {
-		url := "https://www.google.com"
-		shortUrl := "google.com/7378mDnD"
-
-		val := testStore.Create(url, shortUrl)
-		assert.Equal(t, val, true)
-	})
-	t.Run("Create Existing Domain Success", func(t *testing.T) {
-		url := "https://www.google.com/1234"
-		shortUrl := "google.com/7378mDnD"
-
-		val := testStore.Create(url, shortUrl)
-		assert.Equal(t, val, true)
+func TestDB_Store(t *testing.T) {
+	testStore(t, func(t *testing.T) interfaces.Store {
+		db := NewStore(context.Background())
+		t.Cleanup(func() { db.Close(context.Background()) })
+		return db
 	})
 }
 
-func TestDB_GetByURL(t *testing.T) {
-	testStore := NewStore()
-	t.Run("Get By URL Success", func(t *testing.T) {
-		url := "https://www.google.com"
-		shortUrl := "google.com/7378mDnD"
-		testStore.Create(url, shortUrl)
-		val := testStore.GetByURL(url)
-		assert.Equal(t, val, shortUrl)
-	})
+func TestDB_Janitor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := newDB(ctx, 10*time.Millisecond)
 
-	t.Run("Empty URL", func(t *testing.T) {
-		url := ""
-		val := testStore.GetByURL(url)
-		assert.Equal(t, val, "")
-	})
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	assert.Nil(t, db.Create(ctx, &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	assert.Nil(t, db.Create(ctx, &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf"}))
+	for _, shortURL := range []string{"google.com/7378mDnD", "youtube.com/46O6pjZf"} {
+		assert.Nil(t, db.RecordClick(ctx, &models.ClickCollection{ShortURL: shortURL, Timestamp: time.Now()}))
+	}
+
+	assert.Eventually(t, func() bool {
+		_, err := db.GetByURL(ctx, "https://www.google.com")
+		return errors.Is(err, interfaces.ErrNotFound)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := db.GetByURL(ctx, "https://www.youtube.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.removeExpired(time.Now()))
+
+	// The clicks of the removed link are removed along with it
+	db.clicksMu.RLock()
+	defer db.clicksMu.RUnlock()
+	assert.NotContains(t, db.clicksMap, "google.com/7378mDnD")
+	assert.Contains(t, db.clicksMap, "youtube.com/46O6pjZf")
 }
 
-func TestDB_GetByShortURL(t *testing.T) {
-	testStore := NewStore()
-	t.Run("Get By Short URL Success", func(t *testing.T) {
-		url := "https://www.google.com"
-		shortUrl := "google.com/7378mDnD"
-		testStore.Create(url, shortUrl)
-		val := testStore.GetByShortURL(shortUrl)
-		assert.Equal(t, val, url)
-	})
+func TestDB_Close(t *testing.T) {
+	testStore := NewStore(context.Background())
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}))
 
-	t.Run("Empty Short URL", func(t *testing.T) {
-		ShortURL := ""
-		val := testStore.GetByShortURL(ShortURL)
-		assert.Equal(t, val, "")
-	})
+	assert.Nil(t, testStore.Close(context.Background()))
+	assert.Nil(t, testStore.Close(context.Background()))
+
+	val, err := testStore.GetByURL(context.Background(), "https://www.google.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "google.com/7378mDnD", val.ShortURL)
 }
-func TestDB_GetTopThreeDomains(t *testing.T) {
+
+func TestDB_GetTopDomains(t *testing.T) {
 	dmc := []models.DomainMetricsCollection{
 		{Domain: "youtube.com", Counter: 3},
 		{Domain: "google.com", Counter: 2},
@@ -71,6 +74,7 @@ func TestDB_GetTopThreeDomains(t *testing.T) {
 	tests := []struct {
 		name   string
 		fields fields
+		query  models.DomainMetricsQuery
 		want   []models.DomainMetricsCollection
 	}{
 		{
@@ -78,13 +82,15 @@ func TestDB_GetTopThreeDomains(t *testing.T) {
 			fields: fields{
 				metricsMap: map[string]int{"google.com": 2, "infracloud.com": 2, "youtube.com": 3, "facebook": 1},
 			},
-			want: dmc,
+			query: models.DomainMetricsQuery{Limit: 3},
+			want:  dmc,
 		},
 		{
 			name: "Less than three Domains Success",
 			fields: fields{
 				metricsMap: map[string]int{"infracloud.com": 2, "youtube.com": 3},
 			},
+			query: models.DomainMetricsQuery{Limit: 3},
 			want: []models.DomainMetricsCollection{
 				{Domain: "youtube.com", Counter: 3},
 				{Domain: "infracloud.com", Counter: 2},
@@ -95,7 +101,27 @@ func TestDB_GetTopThreeDomains(t *testing.T) {
 			fields: fields{
 				metricsMap: map[string]int{},
 			},
-			want: nil,
+			query: models.DomainMetricsQuery{Limit: 3},
+			want:  nil,
+		},
+		{
+			name: "Second Page",
+			fields: fields{
+				metricsMap: map[string]int{"google.com": 2, "infracloud.com": 2, "youtube.com": 3, "facebook.com": 1, "mongodb.com": 5},
+			},
+			query: models.DomainMetricsQuery{Limit: 2, Offset: 2},
+			want: []models.DomainMetricsCollection{
+				{Domain: "google.com", Counter: 2},
+				{Domain: "infracloud.com", Counter: 2},
+			},
+		},
+		{
+			name: "Offset Past The End",
+			fields: fields{
+				metricsMap: map[string]int{"google.com": 2, "youtube.com": 3},
+			},
+			query: models.DomainMetricsQuery{Limit: 3, Offset: 2},
+			want:  nil,
 		},
 	}
 	for _, tt := range tests {
@@ -103,9 +129,102 @@ func TestDB_GetTopThreeDomains(t *testing.T) {
 			db := &DB{
 				metricsMap: tt.fields.metricsMap,
 			}
-			if got := db.GetTopThreeDomains(); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("DB.GetTopThreeDomains() = %v, want %v", got, tt.want)
+			if got, _ := db.GetTopDomains(context.Background(), &tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetTopDomains() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestDB_ClickHistory(t *testing.T) {
+	testStore := NewStore(context.Background())
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	shortURL := "cricbuzz.com/abcdefgh"
+	for i := 0; i < maxClickHistory+10; i++ {
+		err := testStore.RecordClick(context.Background(), &models.ClickCollection{ShortURL: shortURL, Timestamp: since.Add(time.Duration(i) * time.Second)})
+		assert.Nil(t, err)
+	}
+	stats, err := testStore.GetClickStats(context.Background(), &models.ClickQuery{
+		ShortURL: shortURL,
+		Since:    since,
+		Until:    since.Add(24 * time.Hour),
+		Interval: 24 * time.Hour,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, maxClickHistory+10, stats.Total)
+	// The oldest clicks were dropped from the buckets
+	assert.Equal(t, []models.ClickBucket{{Start: since, Count: maxClickHistory}}, stats.Buckets)
+}
+
+func TestDB_ShortURLIndex(t *testing.T) {
+	db := newDB(context.Background(), janitorInterval)
+	defer db.Close(context.Background())
+	expiresAt := time.Now().Add(-time.Minute)
+	assert.Nil(t, db.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+
+	// Replacing the expired link of the url frees its short url
+	assert.Nil(t, db.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/Hb6Vw0Ke"}))
+	_, err := db.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+	assert.Nil(t, db.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com/maps", ShortURL: "google.com/7378mDnD"}))
+	val, err := db.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.google.com/maps", val.URL)
+
+	links, index := 0, 0
+	for i := range db.shards {
+		links += len(db.shards[i].urlMap)
+		index += len(db.shards[i].shortMap)
+		for short, url := range db.shards[i].shortMap {
+			assert.Equal(t, short, db.shards[shardOf(url)].urlMap[url].ShortURL)
+		}
+	}
+	assert.Equal(t, 2, links)
+	assert.Equal(t, 2, index)
+}
+
+func TestDB_Concurrent(t *testing.T) {
+	db := newDB(context.Background(), time.Millisecond)
+	defer db.Close(context.Background())
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				url := fmt.Sprintf("https://www.google.com/%d", i)
+				shortURL := fmt.Sprintf("google.com/%d", (i+w)%50)
+				var expiresAt *time.Time
+				if i%3 == 0 {
+					past := time.Now().Add(-time.Second)
+					expiresAt = &past
+				}
+				err := db.Create(ctx, &models.UrlCollection{URL: url, ShortURL: shortURL, ExpiresAt: expiresAt})
+				if err != nil && !errors.Is(err, interfaces.ErrConflict) {
+					t.Errorf("unexpected error %v", err)
+				}
+				if link, err := db.GetByShortURL(ctx, shortURL); err == nil && link.ShortURL != shortURL {
+					t.Errorf("short url %v returned the link of %v", shortURL, link.ShortURL)
+				}
+				db.GetByURL(ctx, url)
+				db.RecordClick(ctx, &models.ClickCollection{ShortURL: shortURL, Timestamp: time.Now()})
+				db.GetTopDomains(ctx, &models.DomainMetricsQuery{Limit: 3, Since: time.Now().Add(-time.Hour)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	db.removeExpired(time.Now())
+
+	// Every live short url maps to exactly one link which maps back to it
+	for i := range db.shards {
+		for short, url := range db.shards[i].shortMap {
+			assert.Equal(t, short, db.shards[shardOf(url)].urlMap[url].ShortURL)
+		}
+		for url, link := range db.shards[i].urlMap {
+			assert.Equal(t, url, db.shards[shardOf(link.ShortURL)].shortMap[link.ShortURL])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/monitoring"
+)
+
+// InstrumentedStore records the latency and errors of every call to the wrapped store
+type InstrumentedStore struct {
+	backend string
+	store   interfaces.Store
+}
+
+// NewInstrumentedStore wraps the store, its metrics are labelled with the backend name
+func NewInstrumentedStore(backend string, store interfaces.Store) interfaces.Store {
+	return &InstrumentedStore{backend: backend, store: store}
+}
+
+// observe records an operation which started at start. Entries which are not
+// found are an expected outcome and not counted as errors.
+func (s *InstrumentedStore) observe(operation string, start time.Time, err error) {
+	monitoring.StoreOperationDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+		monitoring.StoreOperationErrors.WithLabelValues(s.backend, operation).Inc()
+	}
+}
+
+func (s *InstrumentedStore) Create(ctx context.Context, link *models.UrlCollection) error {
+	start := time.Now()
+	err := s.store.Create(ctx, link)
+	s.observe("create", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	start := time.Now()
+	link, err := s.store.GetByURL(ctx, url)
+	s.observe("get_by_url", start, err)
+	return link, err
+}
+
+func (s *InstrumentedStore) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	start := time.Now()
+	link, err := s.store.GetByShortURL(ctx, shortURL)
+	s.observe("get_by_short_url", start, err)
+	return link, err
+}
+
+func (s *InstrumentedStore) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	start := time.Now()
+	domains, err := s.store.GetTopDomains(ctx, query)
+	s.observe("get_top_domains", start, err)
+	return domains, err
+}
+
+func (s *InstrumentedStore) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	start := time.Now()
+	err := s.store.RecordClick(ctx, click)
+	s.observe("record_click", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	start := time.Now()
+	stats, err := s.store.GetClickStats(ctx, query)
+	s.observe("get_click_stats", start, err)
+	return stats, err
+}
+
+func (s *InstrumentedStore) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.store.Ping(ctx)
+	s.observe("ping", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) Close(ctx context.Context) error {
+	start := time.Now()
+	err := s.store.Close(ctx)
+	s.observe("close", start, err)
+	return err
+}
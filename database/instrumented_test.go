@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/monitoring"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentedStore(t *testing.T) {
+	testStore := NewInstrumentedStore("test", NewStore(context.Background()))
+	link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}
+
+	assert.Nil(t, testStore.Create(context.Background(), link))
+	_, err := testStore.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+	assert.NotNil(t, err)
+	assert.NotNil(t, testStore.Create(context.Background(), link))
+
+	assert.Equal(t, uint64(2), monitoring.StoreOperationDuration.WithLabelValues("test", "create").Count())
+	assert.Equal(t, uint64(1), monitoring.StoreOperationDuration.WithLabelValues("test", "get_by_short_url").Count())
+	assert.Equal(t, float64(1), monitoring.StoreOperationErrors.WithLabelValues("test", "create").Value())
+	assert.Equal(t, float64(0), monitoring.StoreOperationErrors.WithLabelValues("test", "get_by_short_url").Value())
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration is one version of the schema of a sql store. Its statements are
+// run in order, in the same transaction as the bump of the schema version.
+type migration struct {
+	name       string
+	statements []string
+}
+
+// migrate brings the schema of db up to date. The migrations are versioned by
+// their position in the slice starting at 1, applied migrations must never be
+// edited or removed, only new ones appended.
+//
+// lock is run at the start of every migration transaction, so that replicas
+// starting at the same time apply each migration once. It may be empty when
+// the transactions of the database are serialized already.
+func migrate(ctx context.Context, db *sql.DB, lock string, migrations []migration) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", current, len(migrations))
+	}
+
+	for i, m := range migrations {
+		version := i + 1
+		applied, err := applyMigration(ctx, db, lock, version, m)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d %v: %w", version, m.name, err)
+		}
+		if applied {
+			log.Printf("Applied migration %d %v", version, m.name)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs the statements of m and records its version, unless the
+// version was applied already. A failed migration is rolled back as a whole.
+func applyMigration(ctx context.Context, db *sql.DB, lock string, version int, m migration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return false, err
+		}
+	}
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return false, err
+	}
+	if current >= version {
+		return false, nil
+	}
+	if current != version-1 {
+		return false, fmt.Errorf("schema version is %d", current)
+	}
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, err
+		}
+	}
+	// The values are formatted in the statement as the placeholders differ
+	// between the sql drivers, the name is a constant of the package
+	record := fmt.Sprintf(`INSERT INTO schema_migrations (version, name) VALUES (%d, '%s')`, version, m.name)
+	if _, err := tx.ExecContext(ctx, record); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer db.Close()
+	migrations := []migration{
+		{name: "create_a", statements: []string{`CREATE TABLE a (id INTEGER)`}},
+		{name: "create_b", statements: []string{`CREATE TABLE b (id INTEGER)`, `INSERT INTO b VALUES (1)`}},
+	}
+
+	t.Run("Apply All", func(t *testing.T) {
+		assert.Nil(t, migrate(context.Background(), db, "", migrations))
+
+		var version int
+		assert.Nil(t, db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+		assert.Equal(t, 2, version)
+	})
+
+	t.Run("Applied Once", func(t *testing.T) {
+		assert.Nil(t, migrate(context.Background(), db, "", migrations))
+
+		var count int
+		assert.Nil(t, db.QueryRow(`SELECT COUNT(*) FROM b`).Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Failed Migration Is Rolled Back", func(t *testing.T) {
+		failing := append(migrations, migration{name: "create_c", statements: []string{
+			`CREATE TABLE c (id INTEGER)`,
+			`INSERT INTO missing VALUES (1)`,
+		}})
+		assert.NotNil(t, migrate(context.Background(), db, "", failing))
+
+		var version int
+		assert.Nil(t, db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+		assert.Equal(t, 2, version)
+		_, err := db.Exec(`SELECT * FROM c`)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Newer Schema", func(t *testing.T) {
+		assert.NotNil(t, migrate(context.Background(), db, "", migrations[:1]))
+	})
+}
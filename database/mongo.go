@@ -2,8 +2,14 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 	"url-shortener/interfaces"
 	"url-shortener/models"
 	"url-shortener/utils"
@@ -11,154 +17,385 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 // MongoDB
 type MongoDB struct {
-	context           context.Context
 	db                *mongo.Database
 	client            *mongo.Client
 	urlCollection     *mongo.Collection
 	metricsCollection *mongo.Collection
+	clicksCollection  *mongo.Collection
 }
 
-func mongoDBConn() *mongo.Client {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		log.Printf("Error while connecting to db, %v", err)
-		return nil
+// MongoOptions are the connection settings of the mongo store
+type MongoOptions struct {
+	URI      string
+	Database string
+	// ConnectTimeout bounds the dial of a connection, ServerSelectionTimeout
+	// how long an operation waits for a server to be available
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	MaxPoolSize            uint64
+	// Username, Password and AuthSource override the credentials of the URI
+	// when Username is set
+	Username   string
+	Password   string
+	AuthSource string
+	// TLS enables TLS for the connections, verified with the system roots or
+	// with the certificates of TLSCAFile when it is set
+	TLS       bool
+	TLSCAFile string
+	// PingAttempts is how often the server is pinged on start up, the wait
+	// between the attempts starts at PingBackoff and doubles every time
+	PingAttempts int
+	PingBackoff  time.Duration
+}
+
+// clientOptions returns the options of the driver for opts, the settings of
+// opts take precedence over the ones of the URI
+func (opts MongoOptions) clientOptions() (*options.ClientOptions, error) {
+	co := options.Client().ApplyURI(opts.URI)
+	if opts.ConnectTimeout > 0 {
+		co.SetConnectTimeout(opts.ConnectTimeout)
+	}
+	if opts.ServerSelectionTimeout > 0 {
+		co.SetServerSelectionTimeout(opts.ServerSelectionTimeout)
+	}
+	if opts.MaxPoolSize > 0 {
+		co.SetMaxPoolSize(opts.MaxPoolSize)
+	}
+	if opts.Username != "" {
+		co.SetAuth(options.Credential{Username: opts.Username, Password: opts.Password, AuthSource: opts.AuthSource})
 	}
+	if opts.TLS {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.TLSCAFile != "" {
+			pem, err := os.ReadFile(opts.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the CA file: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in %v", opts.TLSCAFile)
+			}
+		}
+		co.SetTLSConfig(tlsConfig)
+	}
+	return co, co.Validate()
+}
 
-	return client
+// pingWithRetry pings the primary up to attempts times, doubling the wait
+// between the attempts, until it answers or ctx is done
+func pingWithRetry(ctx context.Context, client *mongo.Client, attempts int, backoff time.Duration) error {
+	var err error
+	for i := 1; ; i++ {
+		if err = client.Ping(ctx, readpref.Primary()); err == nil {
+			return nil
+		}
+		if i >= attempts {
+			return err
+		}
+		log.Printf("Failed to ping the database, attempt %v of %v. %v", i, attempts, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
 }
 
-func NewMongo(ctx context.Context) interfaces.Store {
-	client := mongoDBConn()
-	db := client.Database("url-shortner")
+// NewMongo connects to the mongodb of opts, waits until it answers and creates
+// the indexes of the store. The client is disconnected again when any of
+// these fail.
+func NewMongo(ctx context.Context, opts MongoOptions) (interfaces.Store, error) {
+	co, err := opts.clientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+	}
+	client, err := mongo.Connect(ctx, co)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	if err := pingWithRetry(ctx, client, opts.PingAttempts, opts.PingBackoff); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	}
+
+	db := client.Database(opts.Database)
 	mg := &MongoDB{
-		context:           ctx,
 		db:                db,
 		client:            client,
 		urlCollection:     db.Collection("url"),
 		metricsCollection: db.Collection("metrics"),
+		clicksCollection:  db.Collection("clicks"),
+	}
+	if err := mg.createIndexes(ctx); err != nil {
+		client.Disconnect(context.Background())
+		return nil, mongoError(err)
+	}
+	return mg, nil
+}
+
+// createIndexes creates the indexes of the store. Creating an index which
+// already exists with the same keys and options does nothing, so this runs on
+// every start up.
+func (mg *MongoDB) createIndexes(ctx context.Context) error {
+	// url and short_url have to be unique so that concurrent creations cannot
+	// claim the same url or code, domain so that the counters are upserted once
+	indexes := []struct {
+		collection *mongo.Collection
+		model      mongo.IndexModel
+	}{
+		{mg.urlCollection, mongo.IndexModel{Keys: bson.D{{Key: "url", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{mg.urlCollection, mongo.IndexModel{Keys: bson.D{{Key: "short_url", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		// Mongo removes the links once their expires_at has passed, links without it are kept
+		{mg.urlCollection, mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}},
+		{mg.metricsCollection, mongo.IndexModel{Keys: bson.D{{Key: "domain", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{mg.clicksCollection, mongo.IndexModel{Keys: bson.D{{Key: "short_url", Value: 1}, {Key: "timestamp", Value: 1}}}},
+	}
+	for _, index := range indexes {
+		if _, err := index.collection.Indexes().CreateOne(ctx, index.model); err != nil {
+			return fmt.Errorf("failed to create the index %v on %v: %w", index.model.Keys, index.collection.Name(), err)
+		}
+	}
+	return nil
+}
+
+// shortURLConflict reports whether the insert was rejected by the unique index
+// on short_url, the message of its write error names the index
+func shortURLConflict(err error) bool {
+	var writeErr mongo.WriteException
+	if !errors.As(err, &writeErr) {
+		return false
+	}
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == 11000 && strings.Contains(e.Message, "index: short_url_1 ") {
+			return true
+		}
 	}
-	return mg
+	return false
 }
 
-func (mg *MongoDB) Create(url, shortURL string) bool {
-	domain := utils.GetDomain(url)
+// mongoError translates a driver error into one of the errors of the interfaces package.
+func mongoError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return fmt.Errorf("%w: %v", interfaces.ErrNotFound, err)
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %v", interfaces.ErrConflict, err)
+	case mongo.IsNetworkError(err), mongo.IsTimeout(err), errors.Is(err, mongo.ErrClientDisconnected),
+		errors.As(err, &topology.ServerSelectionError{}):
+		return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	}
+	return err
+}
+
+// Create inserts the link and increments the counter of its domain in a
+// transaction. The unique indexes on url and short_url reject conflicting
+// links, the counter is upserted with $inc so that concurrent creations do not
+// lose increments.
+func (mg *MongoDB) Create(ctx context.Context, link *models.UrlCollection) error {
+	if link.URL == "" || link.ShortURL == "" {
+		return fmt.Errorf("%w: url and short url are required", interfaces.ErrInvalidArgument)
+	}
+
+	domain := utils.GetDomain(link.URL)
+	link.Domain = domain
 	session, err := mg.client.StartSession()
 	if err != nil {
 		log.Printf("Failed to start sesssion. %v", err)
-		return false
+		return mongoError(err)
 	}
+	defer session.EndSession(context.Background())
 
-	err = mongo.WithSession(context.Background(), session, func(sessionContext mongo.SessionContext) error {
-		if err = session.StartTransaction(); err != nil {
-			return err
+	// WithTransaction commits when the callback succeeds and aborts otherwise,
+	// transient errors such as write conflicts are retried
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		// The TTL monitor only runs every minute, expired links which are still
+		// present must not block a new link for the same url or short url
+		expired := bson.M{
+			"$or":        bson.A{bson.M{"url": link.URL}, bson.M{"short_url": link.ShortURL}},
+			"expires_at": bson.M{"$lte": time.Now()},
 		}
-		_, err := mg.urlCollection.InsertOne(mg.context, models.UrlCollection{URL: url, ShortURL: shortURL, Domain: domain})
-		if err != nil {
-			log.Printf("Error while inserting the value for %v. %v", url, err)
-			return err
+		if _, err := mg.urlCollection.DeleteMany(sessionContext, expired); err != nil {
+			log.Printf("Error while removing the expired links of %v. %v", link.URL, err)
+			return nil, err
 		}
 
-		dm := &models.DomainMetricsCollection{}
-		searchFilter := bson.M{"domain": domain}
-		err = mg.metricsCollection.FindOne(mg.context, searchFilter).Decode(dm)
-		if dm.Counter == 0 {
-			_, err := mg.metricsCollection.InsertOne(mg.context, models.DomainMetricsCollection{Domain: domain, Counter: 1})
-			if err != nil {
-
-				log.Printf("Error while updating the counter for %v in the db. %v", domain, err)
-				return err
-			}
-			return nil
-		}
-		if err != nil {
-			log.Printf("Error while finding the value for %v in the db. %v", domain, err)
-			return err
+		if _, err := mg.urlCollection.InsertOne(sessionContext, link); err != nil {
+			log.Printf("Error while inserting the value for %v. %v", link.URL, err)
+			return nil, err
 		}
 
-		value := dm.Counter + 1
-		update := bson.D{{"$set", bson.D{{"counter", value}}}}
-		_, err = mg.metricsCollection.UpdateOne(mg.context, searchFilter, update)
+		filter := bson.M{"domain": domain}
+		update := bson.M{"$inc": bson.M{"counter": 1}}
+		_, err := mg.metricsCollection.UpdateOne(sessionContext, filter, update, options.Update().SetUpsert(true))
 		if err != nil {
 			log.Printf("Error while updating the counter for %v in the db. %v", domain, err)
-			return err
+			return nil, err
 		}
-
-		if err = session.CommitTransaction(sessionContext); err != nil {
-			log.Printf("Failed to commit the DB transaction. %v", err)
-			return err
-		}
-		return nil
+		return nil, nil
 	})
-
 	if err != nil {
-		if abortErr := session.AbortTransaction(context.Background()); abortErr != nil {
-			panic(abortErr)
+		log.Printf("Failed to create %v. %v", link.URL, err)
+		// The message of the error also holds the duplicate value, so the
+		// index is taken from the write errors rather than the whole message
+		if shortURLConflict(err) {
+			return fmt.Errorf("%w: %v", interfaces.ErrShortURLConflict, err)
 		}
-		log.Printf("Failed to create mongo txn session. %v", err)
-		return false
+		return mongoError(err)
 	}
-
-	defer session.EndSession(mg.context)
-	return true
+	return nil
 }
 
-func (mg *MongoDB) GetByURL(url string) string {
+func (mg *MongoDB) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%w: url is empty", interfaces.ErrInvalidArgument)
+	}
+
 	urlColl := &models.UrlCollection{}
 	searchFilter := bson.M{"url": url}
-	err := mg.urlCollection.FindOne(mg.context, searchFilter).Decode(urlColl)
+	err := mg.urlCollection.FindOne(ctx, searchFilter).Decode(urlColl)
 	if err != nil {
 		log.Printf("Could not find %v in the database", url)
-		return ""
+		return nil, mongoError(err)
 	}
-
-	fmt.Println("Entry Already Present", urlColl.ShortURL)
-	return urlColl.ShortURL
+	return urlColl, nil
 }
 
-func (mg *MongoDB) GetByShortURL(shortUrl string) string {
+func (mg *MongoDB) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	if shortURL == "" {
+		return nil, fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
 	urlColl := &models.UrlCollection{}
-	searchFilter := bson.M{"short_url": shortUrl}
-	err := mg.urlCollection.FindOne(mg.context, searchFilter).Decode(urlColl)
+	searchFilter := bson.M{"short_url": shortURL}
+	err := mg.urlCollection.FindOne(ctx, searchFilter).Decode(urlColl)
 	if err != nil {
-		log.Printf("Error while finding %v in the database", shortUrl)
-		return ""
+		log.Printf("Error while finding %v in the database", shortURL)
+		return nil, mongoError(err)
 	}
-	return urlColl.URL
+	return urlColl, nil
 }
 
-func (mg *MongoDB) GetTopThreeDomains() []models.DomainMetricsCollection {
-	metrics := &[]models.DomainMetricsCollection{}
-	result := []models.DomainMetricsCollection{}
+func (mg *MongoDB) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	if query.Limit < 1 || query.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", interfaces.ErrInvalidArgument)
+	}
+
+	page := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "counter", Value: -1}, {Key: "domain", Value: 1}}}},
+		{{Key: "$skip", Value: query.Offset}},
+		{{Key: "$limit", Value: query.Limit}},
+	}
 
-	opts := options.Find().SetSort(bson.D{{"counter", -1}})
-	cur, err := mg.metricsCollection.Find(mg.context, bson.D{}, opts)
+	// Without a window the counters are read as they are, otherwise the links
+	// created in the window are counted per domain
+	collection := mg.metricsCollection
+	pipeline := page
+	if query.Windowed() {
+		created := bson.M{}
+		if !query.Since.IsZero() {
+			created["$gte"] = query.Since
+		}
+		if !query.Until.IsZero() {
+			created["$lt"] = query.Until
+		}
+		collection = mg.urlCollection
+		pipeline = append(mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"created_at": created}}},
+			{{Key: "$group", Value: bson.M{"_id": "$domain", "counter": bson.M{"$sum": 1}}}},
+			{{Key: "$project", Value: bson.M{"_id": 0, "domain": "$_id", "counter": 1}}},
+		}, page...)
+	}
+
+	cur, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		log.Printf("Error getting details from the database. %v", err)
-		return *metrics
+		return nil, mongoError(err)
 	}
-	err = cur.All(mg.context, metrics)
-	if err != nil {
+
+	var result []models.DomainMetricsCollection
+	if err = cur.All(ctx, &result); err != nil {
 		log.Printf("Error getting all records from the database. %v", err)
-		return *metrics
+		return nil, mongoError(err)
 	}
+	return result, nil
+}
 
-	i := 0
-	for _, metric := range *metrics {
-		if len(*metrics) > 0 && len(*metrics) <= 3 {
-			result = append(result, metric)
-		}
-		if len(*metrics) > 3 {
-			if i == 3 {
-				return result
-			}
-			result = append(result, metric)
-			i++
-		}
+func (mg *MongoDB) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	if click.ShortURL == "" {
+		return fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	_, err := mg.clicksCollection.InsertOne(ctx, click)
+	if err != nil {
+		log.Printf("Error while inserting the click for %v. %v", click.ShortURL, err)
+		return mongoError(err)
+	}
+	return nil
+}
+
+func (mg *MongoDB) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	if query.ShortURL == "" || query.Interval <= 0 {
+		return nil, fmt.Errorf("%w: short url and interval are required", interfaces.ErrInvalidArgument)
+	}
+
+	total, err := mg.clicksCollection.CountDocuments(ctx, bson.M{"short_url": query.ShortURL})
+	if err != nil {
+		log.Printf("Error while counting the clicks of %v. %v", query.ShortURL, err)
+		return nil, mongoError(err)
+	}
+
+	// The start of the bucket of a click is timestamp - ((timestamp - since) mod interval)
+	offset := bson.M{"$mod": bson.A{bson.M{"$subtract": bson.A{"$timestamp", query.Since}}, query.Interval.Milliseconds()}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"short_url": query.ShortURL,
+			"timestamp": bson.M{"$gte": query.Since, "$lt": query.Until},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$subtract": bson.A{"$timestamp", offset}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cur, err := mg.clicksCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Error while aggregating the clicks of %v. %v", query.ShortURL, err)
+		return nil, mongoError(err)
+	}
+
+	stats := &models.ClickStats{Total: int(total)}
+	if err = cur.All(ctx, &stats.Buckets); err != nil {
+		log.Printf("Error getting all click buckets from the database. %v", err)
+		return nil, mongoError(err)
+	}
+	return stats, nil
+}
+
+// Ping checks that the primary of the deployment can be reached
+func (mg *MongoDB) Ping(ctx context.Context) error {
+	if err := mg.client.Ping(ctx, readpref.Primary()); err != nil {
+		return mongoError(err)
+	}
+	return nil
+}
+
+// Close disconnects the client, waiting for in progress operations until ctx is done
+func (mg *MongoDB) Close(ctx context.Context) error {
+	if err := mg.client.Disconnect(ctx); err != nil {
+		log.Printf("Error while disconnecting from the database. %v", err)
+		return mongoError(err)
 	}
-	return result
+	return nil
 }
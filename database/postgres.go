@@ -0,0 +1,349 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/lib/pq"
+)
+
+// postgresMigrations are the versions of the schema of the postgres store
+var postgresMigrations = []migration{
+	{
+		name: "create_links",
+		statements: []string{
+			`CREATE TABLE links (
+				url TEXT NOT NULL CONSTRAINT links_url_key UNIQUE,
+				short_url TEXT NOT NULL CONSTRAINT links_short_url_key UNIQUE,
+				domain TEXT NOT NULL,
+				tags TEXT[],
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX links_created_at ON links (created_at)`,
+			`CREATE INDEX links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL`,
+			`CREATE TABLE domain_metrics (
+				domain TEXT PRIMARY KEY,
+				counter BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		name: "create_clicks",
+		statements: []string{
+			`CREATE TABLE clicks (
+				short_url TEXT NOT NULL,
+				"timestamp" TIMESTAMPTZ NOT NULL,
+				referrer TEXT NOT NULL,
+				user_agent TEXT NOT NULL
+			)`,
+			`CREATE INDEX clicks_short_url_timestamp ON clicks (short_url, "timestamp")`,
+		},
+	},
+	{
+		name: "add_original_url",
+		statements: []string{
+			`ALTER TABLE links ADD COLUMN original_url TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// postgresMigrationLock serializes the migrations of replicas starting at the same time
+const postgresMigrationLock = `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`
+
+// Postgres keeps the links in a postgres database
+type Postgres struct {
+	db     *sql.DB
+	cancel context.CancelFunc
+}
+
+// NewPostgres connects to the postgres database at dsn and migrates its schema.
+// Expired links are removed in the background until the context is done or the
+// store is closed.
+func NewPostgres(ctx context.Context, dsn string, maxOpenConns int) (interfaces.Store, error) {
+	return newPostgres(ctx, dsn, maxOpenConns, janitorInterval)
+}
+
+func newPostgres(ctx context.Context, dsn string, maxOpenConns int, interval time.Duration) (*Postgres, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres dsn: %w", err)
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns)
+
+	if err := migrate(ctx, db, postgresMigrationLock, postgresMigrations); err != nil {
+		db.Close()
+		return nil, postgresError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pg := &Postgres{db: db, cancel: cancel}
+	go janitor(ctx, interval, pg.removeExpired)
+	return pg, nil
+}
+
+// postgresError translates a driver error into one of the errors of the interfaces package.
+func postgresError(err error) error {
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %v", interfaces.ErrNotFound, err)
+	// database/sql does not export the error returned once the pool is closed
+	case errors.Is(err, sql.ErrConnDone), errors.Is(err, driver.ErrBadConn), err.Error() == "sql: database is closed":
+		return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	case errors.As(err, &netErr):
+		return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	case errors.As(err, &pqErr):
+		switch {
+		case pqErr.Code.Name() == "unique_violation":
+			return fmt.Errorf("%w: %v", interfaces.ErrConflict, err)
+		// connection_exception, insufficient_resources and operator_intervention
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57":
+			return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+		}
+	}
+	return err
+}
+
+// removeExpired deletes the links which expired at now and returns how many were deleted
+func (pg *Postgres) removeExpired(now time.Time) (int, error) {
+	res, err := pg.db.Exec(`DELETE FROM links WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, postgresError(err)
+	}
+	removed, err := res.RowsAffected()
+	return int(removed), err
+}
+
+// Create inserts the link and increments the counter of its domain in a single
+// transaction. The unique constraints reject conflicting links, expired links
+// with the same url or short url are replaced.
+func (pg *Postgres) Create(ctx context.Context, link *models.UrlCollection) error {
+	if link.URL == "" || link.ShortURL == "" {
+		return fmt.Errorf("%w: url and short url are required", interfaces.ErrInvalidArgument)
+	}
+
+	link.Domain = utils.GetDomain(link.URL)
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Failed to begin the transaction. %v", err)
+		return postgresError(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM links WHERE (url = $1 OR short_url = $2) AND expires_at <= $3`,
+		link.URL, link.ShortURL, time.Now())
+	if err != nil {
+		log.Printf("Error while removing the expired links of %v. %v", link.URL, err)
+		return postgresError(err)
+	}
+
+	// An existing url is skipped by the arbiter so that it is reported before
+	// a conflicting short url, which fails on its unique constraint
+	res, err := tx.ExecContext(ctx, `INSERT INTO links (url, original_url, short_url, domain, tags, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (url) DO NOTHING`,
+		link.URL, link.OriginalURL, link.ShortURL, link.Domain, pq.Array(link.Tags), link.CreatedAt, link.ExpiresAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == "links_short_url_key" {
+		return fmt.Errorf("%w: %v", interfaces.ErrShortURLConflict, link.ShortURL)
+	}
+	if err != nil {
+		log.Printf("Error while inserting the value for %v. %v", link.URL, err)
+		return postgresError(err)
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("Error while counting the inserted rows for %v. %v", link.URL, err)
+		return postgresError(err)
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%w: %v", interfaces.ErrConflict, link.URL)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO domain_metrics (domain, counter) VALUES ($1, 1)
+		ON CONFLICT (domain) DO UPDATE SET counter = domain_metrics.counter + 1`, link.Domain)
+	if err != nil {
+		log.Printf("Error while updating the counter for %v in the db. %v", link.Domain, err)
+		return postgresError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit the transaction. %v", err)
+		return postgresError(err)
+	}
+	return nil
+}
+
+// getLink returns the link of the single row selected by the condition
+func (pg *Postgres) getLink(ctx context.Context, condition string, arg string) (*models.UrlCollection, error) {
+	var (
+		link      models.UrlCollection
+		expiresAt sql.NullTime
+	)
+	row := pg.db.QueryRowContext(ctx, `SELECT url, original_url, short_url, domain, tags, created_at, expires_at FROM links WHERE `+condition, arg)
+	err := row.Scan(&link.URL, &link.OriginalURL, &link.ShortURL, &link.Domain, pq.Array(&link.Tags), &link.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	link.CreatedAt = link.CreatedAt.UTC()
+	if expiresAt.Valid {
+		t := expiresAt.Time.UTC()
+		link.ExpiresAt = &t
+	}
+	return &link, nil
+}
+
+func (pg *Postgres) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%w: url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	link, err := pg.getLink(ctx, "url = $1", url)
+	if err != nil {
+		log.Printf("Could not find %v in the database", url)
+		return nil, err
+	}
+	return link, nil
+}
+
+func (pg *Postgres) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	if shortURL == "" {
+		return nil, fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	link, err := pg.getLink(ctx, "short_url = $1", shortURL)
+	if err != nil {
+		log.Printf("Error while finding %v in the database", shortURL)
+		return nil, err
+	}
+	return link, nil
+}
+
+// GetTopDomains reads the counters, or counts the links created in the window
+// of the query per domain
+func (pg *Postgres) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	if query.Limit < 1 || query.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", interfaces.ErrInvalidArgument)
+	}
+
+	stmt := `SELECT domain, counter FROM domain_metrics`
+	var args []any
+	if query.Windowed() {
+		var conditions []string
+		if !query.Since.IsZero() {
+			args = append(args, query.Since)
+			conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+		}
+		if !query.Until.IsZero() {
+			args = append(args, query.Until)
+			conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+		}
+		stmt = `SELECT domain, COUNT(*) AS counter FROM links WHERE ` + strings.Join(conditions, " AND ") + ` GROUP BY domain`
+	}
+	args = append(args, query.Limit, query.Offset)
+	stmt += fmt.Sprintf(` ORDER BY counter DESC, domain ASC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := pg.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		log.Printf("Error getting details from the database. %v", err)
+		return nil, postgresError(err)
+	}
+	defer rows.Close()
+
+	var result []models.DomainMetricsCollection
+	for rows.Next() {
+		var dm models.DomainMetricsCollection
+		if err := rows.Scan(&dm.Domain, &dm.Counter); err != nil {
+			return nil, postgresError(err)
+		}
+		result = append(result, dm)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error getting all records from the database. %v", err)
+		return nil, postgresError(err)
+	}
+	return result, nil
+}
+
+func (pg *Postgres) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	if click.ShortURL == "" {
+		return fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	_, err := pg.db.ExecContext(ctx, `INSERT INTO clicks (short_url, "timestamp", referrer, user_agent) VALUES ($1, $2, $3, $4)`,
+		click.ShortURL, click.Timestamp, click.Referrer, click.UserAgent)
+	if err != nil {
+		log.Printf("Error while inserting the click for %v. %v", click.ShortURL, err)
+		return postgresError(err)
+	}
+	return nil
+}
+
+// GetClickStats counts the clicks of the short url in buckets starting at query.Since
+func (pg *Postgres) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	if query.ShortURL == "" || query.Interval <= 0 {
+		return nil, fmt.Errorf("%w: short url and interval are required", interfaces.ErrInvalidArgument)
+	}
+
+	stats := &models.ClickStats{}
+	err := pg.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM clicks WHERE short_url = $1`, query.ShortURL).Scan(&stats.Total)
+	if err != nil {
+		log.Printf("Error while counting the clicks of %v. %v", query.ShortURL, err)
+		return nil, postgresError(err)
+	}
+
+	// The clicks are grouped by the number of intervals between since and their timestamp
+	rows, err := pg.db.QueryContext(ctx, `SELECT FLOOR(EXTRACT(EPOCH FROM "timestamp" - $2::timestamptz) * 1000 / $4)::bigint AS bucket, COUNT(*)
+		FROM clicks WHERE short_url = $1 AND "timestamp" >= $2 AND "timestamp" < $3 GROUP BY bucket ORDER BY bucket`,
+		query.ShortURL, query.Since, query.Until, query.Interval.Milliseconds())
+	if err != nil {
+		log.Printf("Error while aggregating the clicks of %v. %v", query.ShortURL, err)
+		return nil, postgresError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n int64
+		var bucket models.ClickBucket
+		if err := rows.Scan(&n, &bucket.Count); err != nil {
+			return nil, postgresError(err)
+		}
+		bucket.Start = query.Since.Add(time.Duration(n) * query.Interval)
+		stats.Buckets = append(stats.Buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error getting all click buckets from the database. %v", err)
+		return nil, postgresError(err)
+	}
+	return stats, nil
+}
+
+// Ping checks that the database can be reached
+func (pg *Postgres) Ping(ctx context.Context) error {
+	return postgresError(pg.db.PingContext(ctx))
+}
+
+// Close stops the janitor and closes the connections to the database
+func (pg *Postgres) Close(ctx context.Context) error {
+	pg.cancel()
+	if err := pg.db.Close(); err != nil {
+		log.Printf("Error while closing the database. %v", err)
+		return postgresError(err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// postgresDSNEnv names the database used by the integration tests, they are
+// skipped when it is not set. Every test drops the tables of the store first.
+const postgresDSNEnv = "URL_SHORTENER_TEST_POSTGRES_DSN"
+
+func newTestPostgres(t *testing.T) *Postgres {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%v is not set", postgresDSNEnv)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	_, err = db.Exec(`DROP TABLE IF EXISTS links, domain_metrics, clicks, schema_migrations`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to drop the tables: %v", err)
+	}
+
+	pg, err := newPostgres(context.Background(), dsn, 10, janitorInterval)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %v", err)
+	}
+	t.Cleanup(func() { pg.Close(context.Background()) })
+	return pg
+}
+
+func TestPostgres_Store(t *testing.T) {
+	testStore(t, func(t *testing.T) interfaces.Store { return newTestPostgres(t) })
+}
+
+func TestPostgresError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "No Rows", err: sql.ErrNoRows, want: interfaces.ErrNotFound},
+		{name: "Unique Violation", err: &pq.Error{Code: "23505"}, want: interfaces.ErrConflict},
+		{name: "Connection Failure", err: &pq.Error{Code: "08006"}, want: interfaces.ErrUnavailable},
+		{name: "Too Many Connections", err: &pq.Error{Code: "53300"}, want: interfaces.ErrUnavailable},
+		{name: "Admin Shutdown", err: &pq.Error{Code: "57P01"}, want: interfaces.ErrUnavailable},
+		{name: "Bad Connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: interfaces.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, postgresError(tt.err), tt.want)
+		})
+	}
+
+	t.Run("Other Errors", func(t *testing.T) {
+		err := &pq.Error{Code: "42601"}
+		assert.Equal(t, err, postgresError(err))
+		assert.Nil(t, postgresError(nil))
+	})
+}
+
+func TestPostgres_CreateExpired(t *testing.T) {
+	testStore := newTestPostgres(t)
+	expiresAt := time.Now().Add(-time.Minute)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/Hb6Vw0Ke"}))
+	val, err := testStore.GetByURL(context.Background(), "https://www.google.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "google.com/Hb6Vw0Ke", val.ShortURL)
+
+	removed, err := testStore.removeExpired(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestPostgres_Close(t *testing.T) {
+	testStore := newTestPostgres(t)
+	assert.Nil(t, testStore.Ping(context.Background()))
+	assert.Nil(t, testStore.Close(context.Background()))
+
+	err := testStore.Ping(context.Background())
+	assert.True(t, errors.Is(err, interfaces.ErrUnavailable), "unexpected error %v", err)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRedis returns a store backed by an in-process redis, which is also
+// returned to move its clock
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	store, err := NewRedis(context.Background(), "redis://"+m.Addr()+"/0", "test:")
+	if err != nil {
+		t.Fatalf("failed to connect to redis: %v", err)
+	}
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store.(*Redis), m
+}
+
+func TestRedis_Store(t *testing.T) {
+	testStore(t, func(t *testing.T) interfaces.Store {
+		store, _ := newTestRedis(t)
+		return store
+	})
+}
+
+func TestRedis_Keys(t *testing.T) {
+	testStore, m := newTestRedis(t)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}))
+	assert.True(t, m.Exists("test:url:https://www.google.com"))
+	assert.True(t, m.Exists("test:short:google.com/7378mDnD"))
+}
+
+func TestRedis_Expiry(t *testing.T) {
+	testStore, m := newTestRedis(t)
+	expiresAt := time.Now().Add(time.Minute)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	_, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.Nil(t, err)
+
+	m.FastForward(2 * time.Minute)
+	_, err = testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	_, err = testStore.GetByURL(context.Background(), "https://www.google.com")
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+	// Both the url and the short url can be used again
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/Hb6Vw0Ke"}))
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com/1234", ShortURL: "google.com/7378mDnD"}))
+}
+
+func TestRedis_ClicksExpireWithTheLink(t *testing.T) {
+	testStore, m := newTestRedis(t)
+	expiresAt := time.Now().Add(time.Minute)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf"}))
+	for _, shortURL := range []string{"google.com/7378mDnD", "youtube.com/46O6pjZf"} {
+		assert.Nil(t, testStore.RecordClick(context.Background(), &models.ClickCollection{ShortURL: shortURL, Timestamp: time.Now()}))
+	}
+	assert.Greater(t, m.TTL("test:clicks:google.com/7378mDnD"), time.Duration(0))
+
+	m.FastForward(2 * time.Minute)
+	assert.False(t, m.Exists("test:clicks:google.com/7378mDnD"))
+	// The clicks of a link without expiry are kept
+	assert.True(t, m.Exists("test:clicks:youtube.com/46O6pjZf"))
+}
+
+// The counters keep the links which expired, the window only counts the live ones
+func TestRedis_GetTopDomainsExpired(t *testing.T) {
+	testStore, m := newTestRedis(t)
+	week := time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Now().Add(time.Minute)
+	links := []*models.UrlCollection{
+		{URL: "https://www.youtube.com/1", ShortURL: "youtube.com/1", CreatedAt: week.Add(-time.Hour)},
+		{URL: "https://www.google.com/1", ShortURL: "google.com/1", CreatedAt: week},
+		{URL: "https://www.google.com/2", ShortURL: "google.com/2", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.youtube.com/2", ShortURL: "youtube.com/2", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.google.com/3", ShortURL: "google.com/3", CreatedAt: week.Add(time.Hour), ExpiresAt: &expiresAt},
+		{URL: "https://www.mongodb.com/1", ShortURL: "mongodb.com/1", CreatedAt: week.Add(7 * 24 * time.Hour)},
+		{URL: "https://www.cricbuzz.com/1", ShortURL: "cricbuzz.com/1", CreatedAt: week.Add(7 * 24 * time.Hour)},
+	}
+	for _, link := range links {
+		assert.Nil(t, testStore.Create(context.Background(), link))
+	}
+	m.FastForward(2 * time.Minute)
+
+	t.Run("Counters", func(t *testing.T) {
+		got, err := testStore.GetTopDomains(context.Background(), &models.DomainMetricsQuery{Limit: 2})
+		assert.Nil(t, err)
+		assert.Equal(t, []models.DomainMetricsCollection{{Domain: "google.com", Counter: 3}, {Domain: "youtube.com", Counter: 2}}, got)
+	})
+	t.Run("Window Skips Expired Links", func(t *testing.T) {
+		got, err := testStore.GetTopDomains(context.Background(), &models.DomainMetricsQuery{Limit: 10, Since: week, Until: week.Add(7 * 24 * time.Hour)})
+		assert.Nil(t, err)
+		assert.Equal(t, []models.DomainMetricsCollection{{Domain: "google.com", Counter: 2}, {Domain: "youtube.com", Counter: 1}}, got)
+
+		removed, err := m.ZMembers("test:created")
+		assert.Nil(t, err)
+		assert.NotContains(t, removed, "google.com/3")
+	})
+}
+
+func TestRedis_Unavailable(t *testing.T) {
+	testStore, m := newTestRedis(t)
+	addr := m.Addr()
+	assert.Nil(t, testStore.Ping(context.Background()))
+
+	m.Close()
+	assert.ErrorIs(t, testStore.Ping(context.Background()), interfaces.ErrUnavailable)
+	_, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+
+	_, err = NewRedis(context.Background(), "redis://"+addr+"/0", "test:")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	_, err = NewRedis(context.Background(), "localhost:6379", "test:")
+	assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+}
+
+func TestRedis_Close(t *testing.T) {
+	testStore, _ := newTestRedis(t)
+	assert.Nil(t, testStore.Close(context.Background()))
+	assert.ErrorIs(t, testStore.Ping(context.Background()), interfaces.ErrUnavailable)
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteMigrations are the versions of the schema of the sqlite store. The
+// times are stored as unix milliseconds.
+var sqliteMigrations = []migration{
+	{
+		name: "create_links",
+		statements: []string{
+			`CREATE TABLE links (
+				url TEXT NOT NULL,
+				short_url TEXT NOT NULL,
+				domain TEXT NOT NULL,
+				tags TEXT,
+				created_at INTEGER NOT NULL,
+				expires_at INTEGER
+			)`,
+			`CREATE UNIQUE INDEX links_url ON links (url)`,
+			`CREATE UNIQUE INDEX links_short_url ON links (short_url)`,
+			`CREATE INDEX links_created_at ON links (created_at)`,
+			`CREATE INDEX links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL`,
+			`CREATE TABLE domain_metrics (
+				domain TEXT PRIMARY KEY,
+				counter INTEGER NOT NULL
+			)`,
+		},
+	},
+	{
+		name: "create_clicks",
+		statements: []string{
+			`CREATE TABLE clicks (
+				short_url TEXT NOT NULL,
+				timestamp INTEGER NOT NULL,
+				referrer TEXT NOT NULL,
+				user_agent TEXT NOT NULL
+			)`,
+			`CREATE INDEX clicks_short_url_timestamp ON clicks (short_url, timestamp)`,
+		},
+	},
+	{
+		name: "add_original_url",
+		statements: []string{
+			`ALTER TABLE links ADD COLUMN original_url TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// SQLite keeps the links in an embedded sqlite file
+type SQLite struct {
+	db     *sql.DB
+	cancel context.CancelFunc
+}
+
+// NewSQLite opens the sqlite file at path, creating it if needed, and migrates
+// its schema. Expired links are removed in the background until the context is
+// done or the store is closed.
+func NewSQLite(ctx context.Context, path string) (interfaces.Store, error) {
+	return newSQLite(ctx, path, janitorInterval)
+}
+
+func newSQLite(ctx context.Context, path string, interval time.Duration) (*SQLite, error) {
+	// sqlite only has a single writer, the pool is limited to one connection so
+	// that writes wait for each other instead of failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(ctx, db, "", sqliteMigrations); err != nil {
+		db.Close()
+		return nil, sqliteError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &SQLite{db: db, cancel: cancel}
+	go janitor(ctx, interval, s.removeExpired)
+	return s, nil
+}
+
+// sqliteError translates a driver error into one of the errors of the interfaces package.
+func sqliteError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %v", interfaces.ErrNotFound, err)
+	// database/sql does not export the error returned once the pool is closed
+	case errors.Is(err, sql.ErrConnDone), err.Error() == "sql: database is closed":
+		return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+	case errors.As(err, &sqliteErr):
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %v", interfaces.ErrConflict, err)
+		}
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_IOERR, sqlite3.SQLITE_FULL:
+			return fmt.Errorf("%w: %v", interfaces.ErrUnavailable, err)
+		}
+	}
+	return err
+}
+
+// removeExpired deletes the links which expired at now and returns how many were deleted
+func (s *SQLite) removeExpired(now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM links WHERE expires_at <= ?`, now.UnixMilli())
+	if err != nil {
+		return 0, sqliteError(err)
+	}
+	removed, err := res.RowsAffected()
+	return int(removed), err
+}
+
+// Create inserts the link and increments the counter of its domain in a single
+// transaction. Expired links with the same url or short url are replaced.
+func (s *SQLite) Create(ctx context.Context, link *models.UrlCollection) error {
+	if link.URL == "" || link.ShortURL == "" {
+		return fmt.Errorf("%w: url and short url are required", interfaces.ErrInvalidArgument)
+	}
+
+	link.Domain = utils.GetDomain(link.URL)
+	var tags, expiresAt any
+	if len(link.Tags) > 0 {
+		encoded, err := json.Marshal(link.Tags)
+		if err != nil {
+			return fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+		}
+		tags = string(encoded)
+	}
+	if link.ExpiresAt != nil {
+		expiresAt = link.ExpiresAt.UnixMilli()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Failed to begin the transaction. %v", err)
+		return sqliteError(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM links WHERE (url = ? OR short_url = ?) AND expires_at <= ?`,
+		link.URL, link.ShortURL, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Error while removing the expired links of %v. %v", link.URL, err)
+		return sqliteError(err)
+	}
+
+	// A conflicting url is reported before a conflicting short url, the same
+	// way as the other stores do
+	var existing string
+	err = tx.QueryRowContext(ctx, `SELECT url FROM links WHERE url = ? OR short_url = ? ORDER BY url = ? DESC LIMIT 1`,
+		link.URL, link.ShortURL, link.URL).Scan(&existing)
+	switch {
+	case err == nil && existing == link.URL:
+		return fmt.Errorf("%w: %v", interfaces.ErrConflict, link.URL)
+	case err == nil:
+		return fmt.Errorf("%w: %v", interfaces.ErrShortURLConflict, link.ShortURL)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("Error while finding %v in the database. %v", link.ShortURL, err)
+		return sqliteError(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO links (url, original_url, short_url, domain, tags, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		link.URL, link.OriginalURL, link.ShortURL, link.Domain, tags, link.CreatedAt.UnixMilli(), expiresAt)
+	if err != nil {
+		log.Printf("Error while inserting the value for %v. %v", link.URL, err)
+		return sqliteError(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO domain_metrics (domain, counter) VALUES (?, 1)
+		ON CONFLICT (domain) DO UPDATE SET counter = counter + 1`, link.Domain)
+	if err != nil {
+		log.Printf("Error while updating the counter for %v in the db. %v", link.Domain, err)
+		return sqliteError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit the transaction. %v", err)
+		return sqliteError(err)
+	}
+	return nil
+}
+
+// getLink returns the link of the single row selected by the condition
+func (s *SQLite) getLink(ctx context.Context, condition string, arg string) (*models.UrlCollection, error) {
+	var (
+		link      models.UrlCollection
+		tags      sql.NullString
+		createdAt int64
+		expiresAt sql.NullInt64
+	)
+	row := s.db.QueryRowContext(ctx, `SELECT url, original_url, short_url, domain, tags, created_at, expires_at FROM links WHERE `+condition, arg)
+	if err := row.Scan(&link.URL, &link.OriginalURL, &link.ShortURL, &link.Domain, &tags, &createdAt, &expiresAt); err != nil {
+		return nil, sqliteError(err)
+	}
+
+	if tags.Valid {
+		if err := json.Unmarshal([]byte(tags.String), &link.Tags); err != nil {
+			return nil, fmt.Errorf("invalid tags of %v: %v", link.URL, err)
+		}
+	}
+	link.CreatedAt = time.UnixMilli(createdAt).UTC()
+	if expiresAt.Valid {
+		t := time.UnixMilli(expiresAt.Int64).UTC()
+		link.ExpiresAt = &t
+	}
+	return &link, nil
+}
+
+func (s *SQLite) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%w: url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	link, err := s.getLink(ctx, "url = ?", url)
+	if err != nil {
+		log.Printf("Could not find %v in the database", url)
+		return nil, err
+	}
+	return link, nil
+}
+
+func (s *SQLite) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	if shortURL == "" {
+		return nil, fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	link, err := s.getLink(ctx, "short_url = ?", shortURL)
+	if err != nil {
+		log.Printf("Error while finding %v in the database", shortURL)
+		return nil, err
+	}
+	return link, nil
+}
+
+// GetTopDomains reads the counters, or counts the links created in the window
+// of the query per domain
+func (s *SQLite) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	if query.Limit < 1 || query.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", interfaces.ErrInvalidArgument)
+	}
+
+	stmt := `SELECT domain, counter FROM domain_metrics`
+	var args []any
+	if query.Windowed() {
+		var conditions []string
+		if !query.Since.IsZero() {
+			conditions = append(conditions, "created_at >= ?")
+			args = append(args, query.Since.UnixMilli())
+		}
+		if !query.Until.IsZero() {
+			conditions = append(conditions, "created_at < ?")
+			args = append(args, query.Until.UnixMilli())
+		}
+		stmt = `SELECT domain, COUNT(*) AS counter FROM links WHERE ` + strings.Join(conditions, " AND ") + ` GROUP BY domain`
+	}
+	stmt += ` ORDER BY counter DESC, domain ASC LIMIT ? OFFSET ?`
+	args = append(args, query.Limit, query.Offset)
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		log.Printf("Error getting details from the database. %v", err)
+		return nil, sqliteError(err)
+	}
+	defer rows.Close()
+
+	var result []models.DomainMetricsCollection
+	for rows.Next() {
+		var dm models.DomainMetricsCollection
+		if err := rows.Scan(&dm.Domain, &dm.Counter); err != nil {
+			return nil, sqliteError(err)
+		}
+		result = append(result, dm)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error getting all records from the database. %v", err)
+		return nil, sqliteError(err)
+	}
+	return result, nil
+}
+
+func (s *SQLite) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	if click.ShortURL == "" {
+		return fmt.Errorf("%w: short url is empty", interfaces.ErrInvalidArgument)
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO clicks (short_url, timestamp, referrer, user_agent) VALUES (?, ?, ?, ?)`,
+		click.ShortURL, click.Timestamp.UnixMilli(), click.Referrer, click.UserAgent)
+	if err != nil {
+		log.Printf("Error while inserting the click for %v. %v", click.ShortURL, err)
+		return sqliteError(err)
+	}
+	return nil
+}
+
+// GetClickStats counts the clicks of the short url in buckets starting at query.Since
+func (s *SQLite) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	if query.ShortURL == "" || query.Interval <= 0 {
+		return nil, fmt.Errorf("%w: short url and interval are required", interfaces.ErrInvalidArgument)
+	}
+
+	stats := &models.ClickStats{}
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM clicks WHERE short_url = ?`, query.ShortURL).Scan(&stats.Total)
+	if err != nil {
+		log.Printf("Error while counting the clicks of %v. %v", query.ShortURL, err)
+		return nil, sqliteError(err)
+	}
+
+	// The start of the bucket of a click is since + (timestamp - since) / interval * interval
+	since, interval := query.Since.UnixMilli(), query.Interval.Milliseconds()
+	rows, err := s.db.QueryContext(ctx, `SELECT ? + (timestamp - ?) / ? * ? AS start, COUNT(*) FROM clicks
+		WHERE short_url = ? AND timestamp >= ? AND timestamp < ? GROUP BY start ORDER BY start`,
+		since, since, interval, interval, query.ShortURL, since, query.Until.UnixMilli())
+	if err != nil {
+		log.Printf("Error while aggregating the clicks of %v. %v", query.ShortURL, err)
+		return nil, sqliteError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start int64
+		var bucket models.ClickBucket
+		if err := rows.Scan(&start, &bucket.Count); err != nil {
+			return nil, sqliteError(err)
+		}
+		bucket.Start = time.UnixMilli(start).UTC()
+		stats.Buckets = append(stats.Buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error getting all click buckets from the database. %v", err)
+		return nil, sqliteError(err)
+	}
+	return stats, nil
+}
+
+// Ping checks that the sqlite file can still be queried
+func (s *SQLite) Ping(ctx context.Context) error {
+	return sqliteError(s.db.PingContext(ctx))
+}
+
+// Close stops the janitor and closes the sqlite file
+func (s *SQLite) Close(ctx context.Context) error {
+	s.cancel()
+	if err := s.db.Close(); err != nil {
+		log.Printf("Error while closing the database. %v", err)
+		return sqliteError(err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	s, err := newSQLite(context.Background(), filepath.Join(t.TempDir(), "test.db"), janitorInterval)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestSQLite_Store(t *testing.T) {
+	testStore(t, func(t *testing.T) interfaces.Store { return newTestSQLite(t) })
+}
+
+func TestSQLite_Janitor(t *testing.T) {
+	testStore, err := newSQLite(context.Background(), filepath.Join(t.TempDir(), "test.db"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer testStore.Close(context.Background())
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf"}))
+
+	assert.Eventually(t, func() bool {
+		_, err := testStore.GetByURL(context.Background(), "https://www.google.com")
+		return errors.Is(err, interfaces.ErrNotFound)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = testStore.GetByURL(context.Background(), "https://www.youtube.com")
+	assert.Nil(t, err)
+}
+
+func TestSQLite_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	testStore, err := NewSQLite(context.Background(), path)
+	assert.Nil(t, err)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"}))
+	assert.Nil(t, testStore.Close(context.Background()))
+
+	// The migrations are only applied once and the links survive the restart
+	testStore, err = NewSQLite(context.Background(), path)
+	assert.Nil(t, err)
+	defer testStore.Close(context.Background())
+	assert.Nil(t, testStore.Ping(context.Background()))
+
+	val, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.google.com", val.URL)
+
+	var version int
+	assert.Nil(t, testStore.(*SQLite).db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+}
+
+func TestSQLite_Closed(t *testing.T) {
+	testStore := newTestSQLite(t)
+	assert.Nil(t, testStore.Close(context.Background()))
+
+	assert.ErrorIs(t, testStore.Ping(context.Background()), interfaces.ErrUnavailable)
+	_, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+	assert.NotNil(t, err)
+}
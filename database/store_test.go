@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStore runs the tests every backend of the Store interface has to pass.
+// newStore returns an empty store, which it closes once the test is done.
+func testStore(t *testing.T, newStore func(t *testing.T) interfaces.Store) {
+	t.Run("Create", func(t *testing.T) { testStoreCreate(t, newStore(t)) })
+	t.Run("Create Concurrent Collision", func(t *testing.T) { testStoreCreateConcurrentCollision(t, newStore(t)) })
+	t.Run("Create Concurrent Counters", func(t *testing.T) { testStoreCreateConcurrentCounters(t, newStore(t)) })
+	t.Run("Create Expired", func(t *testing.T) { testStoreCreateExpired(t, newStore(t)) })
+	t.Run("Get Top Domains", func(t *testing.T) { testStoreGetTopDomains(t, newStore(t)) })
+	t.Run("Get Click Stats", func(t *testing.T) { testStoreGetClickStats(t, newStore(t)) })
+}
+
+func testStoreCreate(t *testing.T, testStore interfaces.Store) {
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond).UTC()
+
+	t.Run("Create Success", func(t *testing.T) {
+		link := &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", Tags: []string{"search"}, CreatedAt: createdAt, ExpiresAt: &expiresAt}
+		assert.Nil(t, testStore.Create(context.Background(), link))
+		assert.Equal(t, "google.com", link.Domain)
+
+		val, err := testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+		val, err = testStore.GetByURL(context.Background(), "https://www.google.com")
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+	})
+	t.Run("Create With Original URL", func(t *testing.T) {
+		link := &models.UrlCollection{URL: "https://www.google.com/?q=go", OriginalURL: "https://www.Google.com?utm_source=x&q=go", ShortURL: "google.com/ZU0bLNMv", CreatedAt: createdAt}
+		assert.Nil(t, testStore.Create(context.Background(), link))
+
+		val, err := testStore.GetByURL(context.Background(), "https://www.google.com/?q=go")
+		assert.Nil(t, err)
+		assert.Equal(t, link, val)
+	})
+	t.Run("Create Existing Domain Success", func(t *testing.T) {
+		err := testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com/1234", ShortURL: "google.com/Hb6Vw0Ke"})
+		assert.Nil(t, err)
+
+		val, err := testStore.GetByURL(context.Background(), "https://www.google.com/1234")
+		assert.Nil(t, err)
+		assert.Nil(t, val.Tags)
+		assert.Nil(t, val.ExpiresAt)
+	})
+	t.Run("Create Duplicate URL", func(t *testing.T) {
+		err := testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD"})
+		assert.ErrorIs(t, err, interfaces.ErrConflict)
+		assert.NotErrorIs(t, err, interfaces.ErrShortURLConflict)
+	})
+	t.Run("Create Duplicate Short URL", func(t *testing.T) {
+		err := testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com/5678", ShortURL: "google.com/7378mDnD"})
+		assert.ErrorIs(t, err, interfaces.ErrShortURLConflict)
+
+		_, err = testStore.GetByURL(context.Background(), "https://www.google.com/5678")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+	t.Run("Counters Are Not Incremented On Conflict", func(t *testing.T) {
+		got, err := testStore.GetTopDomains(context.Background(), &models.DomainMetricsQuery{Limit: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, []models.DomainMetricsCollection{{Domain: "google.com", Counter: 3}}, got)
+	})
+	t.Run("Unknown URL", func(t *testing.T) {
+		_, err := testStore.GetByURL(context.Background(), "https://www.youtube.com")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		_, err = testStore.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+	t.Run("Invalid Arguments", func(t *testing.T) {
+		assert.ErrorIs(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com"}), interfaces.ErrInvalidArgument)
+		_, err := testStore.GetByURL(context.Background(), "")
+		assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+		_, err = testStore.GetByShortURL(context.Background(), "")
+		assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+	})
+}
+
+func testStoreCreateConcurrentCollision(t *testing.T, testStore interfaces.Store) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("https://www.google.com/%d", i)
+			errs <- testStore.Create(context.Background(), &models.UrlCollection{URL: url, ShortURL: "google.com/7378mDnD"})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, interfaces.ErrShortURLConflict)
+	}
+	assert.Equal(t, 1, created)
+}
+
+func testStoreCreateConcurrentCounters(t *testing.T, testStore interfaces.Store) {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("https://www.youtube.com/%d", i)
+			assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: url, ShortURL: fmt.Sprintf("youtube.com/%d", i)}))
+		}(i)
+	}
+	wg.Wait()
+
+	// No increment of the counter is lost by concurrent creations
+	got, err := testStore.GetTopDomains(context.Background(), &models.DomainMetricsQuery{Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []models.DomainMetricsCollection{{Domain: "youtube.com", Counter: 20}}, got)
+}
+
+func testStoreCreateExpired(t *testing.T, testStore interfaces.Store) {
+	expiresAt := time.Now().Add(-time.Minute)
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/7378mDnD", ExpiresAt: &expiresAt}))
+	assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com", ShortURL: "youtube.com/46O6pjZf", ExpiresAt: &expiresAt}))
+
+	t.Run("Replace Expired URL", func(t *testing.T) {
+		assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.google.com", ShortURL: "google.com/Hb6Vw0Ke"}))
+
+		val, err := testStore.GetByURL(context.Background(), "https://www.google.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "google.com/Hb6Vw0Ke", val.ShortURL)
+		_, err = testStore.GetByShortURL(context.Background(), "google.com/7378mDnD")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+	t.Run("Replace Expired Short URL", func(t *testing.T) {
+		assert.Nil(t, testStore.Create(context.Background(), &models.UrlCollection{URL: "https://www.youtube.com/feed", ShortURL: "youtube.com/46O6pjZf"}))
+
+		val, err := testStore.GetByShortURL(context.Background(), "youtube.com/46O6pjZf")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://www.youtube.com/feed", val.URL)
+		_, err = testStore.GetByURL(context.Background(), "https://www.youtube.com")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+}
+
+func testStoreGetTopDomains(t *testing.T, testStore interfaces.Store) {
+	week := time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC)
+	links := []*models.UrlCollection{
+		{URL: "https://www.youtube.com/1", ShortURL: "youtube.com/1", CreatedAt: week.Add(-time.Hour)},
+		{URL: "https://www.youtube.com/2", ShortURL: "youtube.com/2", CreatedAt: week.Add(-time.Hour)},
+		{URL: "https://www.google.com/1", ShortURL: "google.com/1", CreatedAt: week},
+		{URL: "https://www.google.com/2", ShortURL: "google.com/2", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.youtube.com/3", ShortURL: "youtube.com/3", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.infracloud.com/1", ShortURL: "infracloud.com/1", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.infracloud.com/2", ShortURL: "infracloud.com/2", CreatedAt: week.Add(time.Hour)},
+		{URL: "https://www.mongodb.com/1", ShortURL: "mongodb.com/1", CreatedAt: week.Add(7 * 24 * time.Hour)},
+	}
+	for _, link := range links {
+		assert.Nil(t, testStore.Create(context.Background(), link))
+	}
+
+	tests := []struct {
+		name  string
+		query models.DomainMetricsQuery
+		want  []models.DomainMetricsCollection
+	}{
+		{
+			name:  "Top Three Domains",
+			query: models.DomainMetricsQuery{Limit: 3},
+			want: []models.DomainMetricsCollection{
+				{Domain: "youtube.com", Counter: 3},
+				{Domain: "google.com", Counter: 2},
+				{Domain: "infracloud.com", Counter: 2},
+			},
+		},
+		{
+			name:  "Second Page",
+			query: models.DomainMetricsQuery{Limit: 2, Offset: 2},
+			want: []models.DomainMetricsCollection{
+				{Domain: "infracloud.com", Counter: 2},
+				{Domain: "mongodb.com", Counter: 1},
+			},
+		},
+		{
+			name:  "Offset Past The End",
+			query: models.DomainMetricsQuery{Limit: 3, Offset: 4},
+			want:  nil,
+		},
+		{
+			name:  "Domains Of The Week",
+			query: models.DomainMetricsQuery{Limit: 10, Since: week, Until: week.Add(7 * 24 * time.Hour)},
+			want: []models.DomainMetricsCollection{
+				{Domain: "google.com", Counter: 2},
+				{Domain: "infracloud.com", Counter: 2},
+				{Domain: "youtube.com", Counter: 1},
+			},
+		},
+		{
+			name:  "Since Only",
+			query: models.DomainMetricsQuery{Limit: 1, Since: week.Add(7 * 24 * time.Hour)},
+			want:  []models.DomainMetricsCollection{{Domain: "mongodb.com", Counter: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testStore.GetTopDomains(context.Background(), &tt.query)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("Invalid Limit", func(t *testing.T) {
+		_, err := testStore.GetTopDomains(context.Background(), &models.DomainMetricsQuery{})
+		assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+	})
+}
+
+func testStoreGetClickStats(t *testing.T, testStore interfaces.Store) {
+	shortUrl := "google.com/7378mDnD"
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The two clicks at since are identical and both counted
+	for _, offset := range []time.Duration{-time.Minute, 0, 0, 10 * time.Minute, 90 * time.Minute, 3 * time.Hour} {
+		err := testStore.RecordClick(context.Background(), &models.ClickCollection{ShortURL: shortUrl, Timestamp: since.Add(offset), Referrer: "https://www.bing.com"})
+		assert.Nil(t, err)
+	}
+	// A short url which is a prefix of another one does not count its clicks
+	assert.Nil(t, testStore.RecordClick(context.Background(), &models.ClickCollection{ShortURL: shortUrl + "x", Timestamp: since}))
+	assert.Nil(t, testStore.RecordClick(context.Background(), &models.ClickCollection{ShortURL: "google.com/7378mDn", Timestamp: since}))
+
+	t.Run("Click Stats Success", func(t *testing.T) {
+		stats, err := testStore.GetClickStats(context.Background(), &models.ClickQuery{
+			ShortURL: shortUrl,
+			Since:    since,
+			Until:    since.Add(3 * time.Hour),
+			Interval: time.Hour,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 6, stats.Total)
+		assert.Equal(t, []models.ClickBucket{
+			{Start: since, Count: 3},
+			{Start: since.Add(time.Hour), Count: 1},
+		}, stats.Buckets)
+	})
+
+	t.Run("No Clicks", func(t *testing.T) {
+		stats, err := testStore.GetClickStats(context.Background(), &models.ClickQuery{
+			ShortURL: "infracloud.com/abcdefgh",
+			Since:    since,
+			Until:    since.Add(time.Hour),
+			Interval: time.Hour,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, stats.Total)
+		assert.Empty(t, stats.Buckets)
+	})
+
+	t.Run("Empty Short URL", func(t *testing.T) {
+		err := testStore.RecordClick(context.Background(), &models.ClickCollection{Timestamp: since})
+		assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+
+		_, err = testStore.GetClickStats(context.Background(), &models.ClickQuery{Interval: time.Hour})
+		assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+	})
+}
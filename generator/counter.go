@@ -0,0 +1,34 @@
+package generator
+
+import (
+	"sync/atomic"
+	"time"
+	"url-shortener/interfaces"
+)
+
+// CounterGenerator encodes a monotonic counter in base62, giving the shortest
+// possible codes at the cost of making them easy to enumerate
+type CounterGenerator struct {
+	length int
+	next   atomic.Uint64
+}
+
+// NewCounter returns a counter based code generator. The counter starts at the
+// current unix time in milliseconds so that a restarted service continues above
+// the codes issued before, as long as less than one code per millisecond was issued.
+func NewCounter(length int) interfaces.CodeGenerator {
+	return NewCounterFrom(length, uint64(time.Now().UnixMilli()))
+}
+
+// NewCounterFrom returns a counter based code generator starting at start
+func NewCounterFrom(length int, start uint64) interfaces.CodeGenerator {
+	g := &CounterGenerator{length: length}
+	g.next.Store(start)
+	return g
+}
+
+// Generate returns the next value of the counter, a collision simply moves on
+// to the next value
+func (g *CounterGenerator) Generate(url string, attempt int) (string, error) {
+	return encodeBase62(g.next.Add(1)-1, g.length), nil
+}
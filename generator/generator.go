@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"url-shortener/interfaces"
+)
+
+// Names of the strategies accepted by New
+const (
+	Hash      = "hash"
+	Random    = "random"
+	Counter   = "counter"
+	Snowflake = "snowflake"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// New returns the code generator of the given strategy. The length is the
+// length of the codes, or the minimum length for the counter and snowflake
+// strategies whose codes grow as their value does. The node id is only used
+// by the snowflake strategy and has to be unique per replica.
+func New(strategy string, length int, node int64) (interfaces.CodeGenerator, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("code length must be positive, got %d", length)
+	}
+
+	switch strategy {
+	case Hash:
+		return NewHash(length), nil
+	case Random:
+		return NewRandom(length), nil
+	case Counter:
+		return NewCounter(length), nil
+	case Snowflake:
+		if node < 0 || node > snowflakeMaxNode {
+			return nil, fmt.Errorf("node id must be between 0 and %d, got %d", snowflakeMaxNode, node)
+		}
+		return NewSnowflake(length, node), nil
+	}
+	return nil, fmt.Errorf("unknown code generator %q", strategy)
+}
+
+// encodeBase62 encodes n in base62, left padded with zeros up to length
+func encodeBase62(n uint64, length int) string {
+	var buf [11]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+		if n == 0 {
+			break
+		}
+	}
+
+	code := string(buf[i:])
+	if len(code) < length {
+		code = strings.Repeat("0", length-len(code)) + code
+	}
+	return code
+}
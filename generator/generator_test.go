@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+	"url-shortener/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generate returns the code of the generator, failing the test on an error
+func generate(t *testing.T, g interfaces.CodeGenerator, url string, attempt int) string {
+	code, err := g.Generate(url, attempt)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	return code
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		length   int
+		node     int64
+		wantErr  bool
+	}{
+		{name: "Hash", strategy: Hash, length: 8},
+		{name: "Random", strategy: Random, length: 8},
+		{name: "Counter", strategy: Counter, length: 8},
+		{name: "Snowflake", strategy: Snowflake, length: 8, node: 1023},
+		{name: "Unknown Strategy", strategy: "uuid", length: 8, wantErr: true},
+		{name: "Zero Length", strategy: Hash, length: 0, wantErr: true},
+		{name: "Node Out Of Range", strategy: Snowflake, length: 8, node: 1024, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.strategy, tt.length, tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got == nil {
+				t.Errorf("New() returned a nil generator")
+			}
+		})
+	}
+}
+
+func TestHashGenerator(t *testing.T) {
+	url := "https://www.google.com"
+	g := NewHash(8)
+
+	t.Run("Code Of The URL", func(t *testing.T) {
+		assert.Equal(t, "7378mDnD", generate(t, g, url, 0))
+	})
+	t.Run("Deterministic", func(t *testing.T) {
+		assert.Equal(t, generate(t, g, url, 0), generate(t, g, url, 0))
+	})
+	t.Run("Later Attempts Are Salted And Extended", func(t *testing.T) {
+		first := generate(t, g, url, 0)
+		second := generate(t, g, url, 1)
+		assert.NotEqual(t, first, second)
+		assert.Equal(t, 9, len(second))
+	})
+	t.Run("Length Is Capped By The Hash", func(t *testing.T) {
+		assert.Equal(t, 28, len(generate(t, NewHash(40), url, 0)))
+	})
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g := NewRandom(12)
+	pattern := regexp.MustCompile(`^[0-9A-Za-z]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code := generate(t, g, "https://www.google.com", 0)
+		if !pattern.MatchString(code) {
+			t.Fatalf("Generate() = %v, want 12 base62 characters", code)
+		}
+		seen[code] = true
+	}
+	assert.Equal(t, 100, len(seen))
+}
+
+func TestRandomGenerator_Failure(t *testing.T) {
+	g := &RandomGenerator{length: 8, random: iotest.ErrReader(errors.New("entropy exhausted"))}
+	code, err := g.Generate("https://www.google.com", 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "", code)
+}
+
+func TestCounterGenerator(t *testing.T) {
+	t.Run("Monotonic", func(t *testing.T) {
+		g := NewCounterFrom(4, 61)
+		assert.Equal(t, "000z", generate(t, g, "", 0))
+		assert.Equal(t, "0010", generate(t, g, "", 0))
+		assert.Equal(t, "0011", generate(t, g, "", 1))
+	})
+	t.Run("Concurrent Codes Are Unique", func(t *testing.T) {
+		g := NewCounter(1)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code := generate(t, g, "", 0)
+				mu.Lock()
+				seen[code] = true
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 50, len(seen))
+	})
+}
+
+func TestSnowflakeGenerator(t *testing.T) {
+	now := snowflakeEpoch.Add(time.Hour)
+	newGenerator := func(node int64) *SnowflakeGenerator {
+		g := NewSnowflake(1, node).(*SnowflakeGenerator)
+		g.now = func() time.Time { return now }
+		return g
+	}
+
+	t.Run("Sequence Within A Millisecond", func(t *testing.T) {
+		g := newGenerator(1)
+		first := generate(t, g, "", 0)
+		second := generate(t, g, "", 0)
+		assert.NotEqual(t, first, second)
+		assert.Equal(t, int64(1), g.sequence)
+	})
+	t.Run("Nodes Do Not Collide", func(t *testing.T) {
+		assert.NotEqual(t, generate(t, newGenerator(1), "", 0), generate(t, newGenerator(2), "", 0))
+	})
+	t.Run("Exhausted Sequence Moves To The Next Millisecond", func(t *testing.T) {
+		g := newGenerator(1)
+		seen := map[string]bool{}
+		for i := 0; i <= snowflakeMaxSequence+1; i++ {
+			seen[generate(t, g, "", 0)] = true
+		}
+		assert.Equal(t, snowflakeMaxSequence+2, len(seen))
+		assert.Equal(t, now.Sub(snowflakeEpoch).Milliseconds()+1, g.last)
+	})
+	t.Run("Clock Moving Backwards", func(t *testing.T) {
+		g := newGenerator(1)
+		first := generate(t, g, "", 0)
+		g.now = func() time.Time { return now.Add(-time.Second) }
+		second := generate(t, g, "", 0)
+		assert.NotEqual(t, first, second)
+		assert.Equal(t, now.Sub(snowflakeEpoch).Milliseconds(), g.last)
+	})
+}
+
+func TestEncodeBase62(t *testing.T) {
+	assert.Equal(t, "0", encodeBase62(0, 1))
+	assert.Equal(t, "z", encodeBase62(61, 1))
+	assert.Equal(t, "10", encodeBase62(62, 1))
+	assert.Equal(t, "00010", encodeBase62(62, 5))
+	assert.Equal(t, "LygHa16AHYF", encodeBase62(1<<64-1, 1))
+}
@@ -0,0 +1,37 @@
+package generator
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"url-shortener/interfaces"
+)
+
+// HashGenerator derives the code from the SHA-1 of the url, the same url
+// always gets the same code
+type HashGenerator struct {
+	length int
+}
+
+// NewHash returns a hash based code generator
+func NewHash(length int) interfaces.CodeGenerator {
+	return &HashGenerator{length: length}
+}
+
+// Generate returns the first characters of the base64 encoded hash of the url.
+// Every attempt after the first salts the hash with the attempt number and
+// extends the code by one character.
+func (g *HashGenerator) Generate(url string, attempt int) (string, error) {
+	input := url
+	if attempt > 0 {
+		input = fmt.Sprintf("%s#%d", url, attempt)
+	}
+
+	sum := sha1.Sum([]byte(input))
+	code := base64.URLEncoding.EncodeToString(sum[:])
+	length := g.length + attempt
+	if length > len(code) {
+		length = len(code)
+	}
+	return code[:length], nil
+}
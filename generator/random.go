@@ -0,0 +1,37 @@
+package generator
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"url-shortener/interfaces"
+)
+
+// RandomGenerator returns random base62 codes, which cannot be enumerated
+// but gives every creation of the same url a different code
+type RandomGenerator struct {
+	length int
+	// random is the source of the codes, crypto/rand outside of tests
+	random io.Reader
+}
+
+// NewRandom returns a random code generator
+func NewRandom(length int) interfaces.CodeGenerator {
+	return &RandomGenerator{length: length, random: rand.Reader}
+}
+
+// Generate returns a new random code, the url and attempt are not used. It
+// fails when the random source cannot be read.
+func (g *RandomGenerator) Generate(url string, attempt int) (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+	code := make([]byte, g.length)
+	for i := range code {
+		n, err := rand.Int(g.random, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		code[i] = base62Alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
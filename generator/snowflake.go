@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"sync"
+	"time"
+	"url-shortener/interfaces"
+)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is the start of the timestamps of the ids, 2024-01-01 UTC
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator returns time ordered ids made of a millisecond timestamp,
+// the node id and a per millisecond sequence, encoded in base62. Nodes with
+// different ids never generate the same code.
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	length   int
+	node     int64
+	last     int64
+	sequence int64
+	now      func() time.Time
+}
+
+// NewSnowflake returns a snowflake code generator for the node, only the lower
+// 10 bits of the node id are used
+func NewSnowflake(length int, node int64) interfaces.CodeGenerator {
+	return &SnowflakeGenerator{length: length, node: node & snowflakeMaxNode, now: time.Now}
+}
+
+// Generate returns the next id, the url and attempt are not used
+func (g *SnowflakeGenerator) Generate(url string, attempt int) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ts := g.now().Sub(snowflakeEpoch).Milliseconds()
+	// Never go back in time, a clock moved backwards keeps using the last timestamp
+	if ts < g.last {
+		ts = g.last
+	}
+	if ts == g.last {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			// The sequence is exhausted for this millisecond, move on to the next one
+			ts++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.last = ts
+
+	id := ts<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | g.sequence
+	return encodeBase62(uint64(id), g.length), nil
+}
@@ -0,0 +1,27 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the Store implementations. Backends wrap these with the
+// underlying driver error so that callers can match them using errors.Is.
+var (
+	// ErrNotFound is returned when no entry exists for the requested key.
+	ErrNotFound = errors.New("entry not found")
+	// ErrConflict is returned when an entry with the same key already exists.
+	ErrConflict = errors.New("entry already exists")
+	// ErrShortURLConflict is returned when the short url is already mapped to another url.
+	// It matches ErrConflict as well.
+	ErrShortURLConflict = fmt.Errorf("short url: %w", ErrConflict)
+	// ErrInvalidArgument is returned when the store is called with an empty or malformed key.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrUnavailable is returned when the backend could not be reached.
+	ErrUnavailable = errors.New("store unavailable")
+	// ErrForbidden is returned when a TargetPolicy rejects the url of a link.
+	ErrForbidden = errors.New("target not allowed")
+	// ErrBlocked is returned when the url of a link is on a deny list. It
+	// matches ErrForbidden as well.
+	ErrBlocked = fmt.Errorf("%w: on the denylist", ErrForbidden)
+)
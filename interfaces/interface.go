@@ -1,21 +1,54 @@
 package interfaces
 
 import (
+	"context"
 	"net/http"
+	"net/url"
 	"url-shortener/models"
 )
 
 // Store has all functions of the db.go as part of the interface.
+// Every call returns one of the errors declared in errors.go on failure.
 type Store interface {
-	Create(url, shortURl string) bool
-	GetByURL(url string) string
-	GetByShortURL(shortUrl string) string
-	GetTopThreeDomains() []models.DomainMetricsCollection
+	Create(ctx context.Context, link *models.UrlCollection) error
+	GetByURL(ctx context.Context, url string) (*models.UrlCollection, error)
+	GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error)
+	// GetTopDomains orders the domains by their counter, domains with the same
+	// counter are ordered by name
+	GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error)
+
+	// RecordClick and GetClickStats are the analytics sink of the redirects.
+	// GetClickStats only returns the buckets which have at least one click.
+	RecordClick(ctx context.Context, click *models.ClickCollection) error
+	GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error)
+
+	// Ping checks that the backend can serve requests, it is used by the
+	// readiness check of the server
+	Ping(ctx context.Context) error
+
+	// Close releases the resources of the store, it is called once the server
+	// has stopped serving requests
+	Close(ctx context.Context) error
+}
+
+// CodeGenerator returns the code used in the short url of a url. The attempt
+// starts at zero and is incremented every time the previous code collided with
+// an existing short url. No code is returned along with an error.
+type CodeGenerator interface {
+	Generate(url string, attempt int) (string, error)
+}
+
+// TargetPolicy decides whether the url can be shortened. It returns an error
+// matching ErrForbidden when the url is rejected.
+type TargetPolicy interface {
+	Check(ctx context.Context, target *url.URL) error
 }
 
 // API has all functions like shortening and redirect as part of the interface
 type API interface {
 	RedirectURL(w http.ResponseWriter, r *http.Request)
 	UrlShortner(w http.ResponseWriter, r *http.Request)
+	CreateLink(w http.ResponseWriter, r *http.Request)
 	Metrics(w http.ResponseWriter, r *http.Request)
+	ClickStats(w http.ResponseWriter, r *http.Request)
 }
@@ -2,16 +2,120 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
 	"url-shortener/api"
+	"url-shortener/config"
 	"url-shortener/database"
+	"url-shortener/generator"
+	"url-shortener/interfaces"
+	"url-shortener/policy"
 	"url-shortener/server"
 )
 
 func main() {
-	ctx := context.Background()
-	// sI := database.NewStore()
-	sI := database.NewMongo(ctx)
-	a := api.NewAPI(ctx, sI)
-	serv := server.NewServer(ctx, a)
-	serv.Start()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration. %v", err)
+	}
+
+	codes, err := generator.New(cfg.Generator.Strategy, cfg.Generator.Length, cfg.Generator.NodeID)
+	if err != nil {
+		log.Fatalf("Invalid code generator. %v", err)
+	}
+
+	// ctx stops the background work of the store and the lists once the
+	// server has shut down
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	var sI interfaces.Store
+	switch cfg.Store.Backend {
+	case config.BackendMemory:
+		sI = database.NewStore(ctx)
+	case config.BackendMongo:
+		sI, err = database.NewMongo(ctx, database.MongoOptions{
+			URI:                    cfg.Mongo.URI,
+			Database:               cfg.Mongo.Database,
+			ConnectTimeout:         cfg.Mongo.ConnectTimeout,
+			ServerSelectionTimeout: cfg.Mongo.ServerSelectionTimeout,
+			MaxPoolSize:            uint64(cfg.Mongo.MaxPoolSize),
+			Username:               cfg.Mongo.Username,
+			Password:               cfg.Mongo.Password,
+			AuthSource:             cfg.Mongo.AuthSource,
+			TLS:                    cfg.Mongo.TLS,
+			TLSCAFile:              cfg.Mongo.TLSCAFile,
+			PingAttempts:           cfg.Mongo.PingAttempts,
+			PingBackoff:            cfg.Mongo.PingBackoff,
+		})
+		if err != nil {
+			log.Fatalf("Failed to connect to mongodb. %v", err)
+		}
+	case config.BackendSQLite:
+		sI, err = database.NewSQLite(ctx, cfg.SQLite.Path)
+		if err != nil {
+			log.Fatalf("Failed to open the sqlite store. %v", err)
+		}
+	case config.BackendPostgres:
+		sI, err = database.NewPostgres(ctx, cfg.Postgres.DSN, cfg.Postgres.MaxOpenConns)
+		if err != nil {
+			log.Fatalf("Failed to connect to postgres. %v", err)
+		}
+	case config.BackendBolt:
+		sI, err = database.NewBolt(ctx, cfg.Bolt.Path, cfg.Bolt.BackupPath, cfg.Bolt.BackupInterval)
+		if err != nil {
+			log.Fatalf("Failed to open the bolt store. %v", err)
+		}
+	case config.BackendRedis:
+		sI, err = database.NewRedis(ctx, cfg.Redis.URL, cfg.Redis.KeyPrefix)
+		if err != nil {
+			log.Fatalf("Failed to connect to redis. %v", err)
+		}
+	}
+	sI = database.NewInstrumentedStore(cfg.Store.Backend, sI)
+	// The cache wraps the instrumented store so that only the calls which
+	// reach the backend are observed
+	if cfg.Cache.Size > 0 {
+		sI = database.NewCachedStore(sI, cfg.Cache.Size, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+	}
+	var network, lists interfaces.TargetPolicy
+	if cfg.API.NetworkPolicy() {
+		// Validate has already parsed the networks
+		networks, _ := policy.ParsePrefixes(cfg.API.BlockedNetworks)
+		network = policy.NewNetwork(policy.NetworkOptions{
+			BlockPrivate:    cfg.API.BlockPrivateTargets,
+			BlockedNetworks: networks,
+			BlockedHosts:    cfg.API.BlockedHosts,
+			ResolveTimeout:  cfg.API.ResolveTimeout,
+		}, net.DefaultResolver)
+	}
+	if cfg.API.DenylistFile != "" || cfg.API.AllowlistFile != "" {
+		lists, err = policy.NewLists(ctx, policy.ListsOptions{
+			DenyFile:       cfg.API.DenylistFile,
+			AllowFile:      cfg.API.AllowlistFile,
+			ReloadInterval: cfg.API.ListsReloadInterval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load the target lists. %v", err)
+		}
+	}
+	// The lists are checked first as they do not need to resolve the host,
+	// only they are checked again on redirects
+	a := api.NewAPI(ctx, sI, codes, cfg.API, policy.Chain(lists, network), lists)
+	serv := server.NewServer(ctx, a, sI, cfg.Server)
+	if err := serv.Start(); err != nil {
+		log.Printf("Server stopped. %v", err)
+	}
+	stop()
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := sI.Close(closeCtx); err != nil {
+		log.Printf("Failed to close the store. %v", err)
+	}
 }
@@ -13,6 +13,16 @@ type API struct {
 	mock.Mock
 }
 
+// ClickStats provides a mock function with given fields: w, r
+func (_m *API) ClickStats(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// CreateLink provides a mock function with given fields: w, r
+func (_m *API) CreateLink(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
 // Metrics provides a mock function with given fields: w, r
 func (_m *API) Metrics(w http.ResponseWriter, r *http.Request) {
 	_m.Called(w, r)
@@ -0,0 +1,52 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+
+// CodeGenerator is an autogenerated mock type for the CodeGenerator type
+type CodeGenerator struct {
+	mock.Mock
+}
+
+// Generate provides a mock function with given fields: url, attempt
+func (_m *CodeGenerator) Generate(url string, attempt int) (string, error) {
+	ret := _m.Called(url, attempt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Generate")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, int) (string, error)); ok {
+		return rf(url, attempt)
+	}
+	if rf, ok := ret.Get(0).(func(string, int) string); ok {
+		r0 = rf(url, attempt)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(url, attempt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewCodeGenerator creates a new instance of CodeGenerator. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewCodeGenerator(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *CodeGenerator {
+	mock := &CodeGenerator{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
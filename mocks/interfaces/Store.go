@@ -3,9 +3,11 @@
 package mocks
 
 import (
-	models "url-shortener/models"
+	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+
+	models "url-shortener/models"
 )
 
 // Store is an autogenerated mock type for the Store type
@@ -13,77 +15,195 @@ type Store struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: url, shortURl
-func (_m *Store) Create(url string, shortURl string) bool {
-	ret := _m.Called(url, shortURl)
+// Close provides a mock function with given fields: ctx
+func (_m *Store) Close(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Close")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Create provides a mock function with given fields: ctx, link
+func (_m *Store) Create(ctx context.Context, link *models.UrlCollection) error {
+	ret := _m.Called(ctx, link)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Create")
 	}
 
-	var r0 bool
-	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
-		r0 = rf(url, shortURl)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.UrlCollection) error); ok {
+		r0 = rf(ctx, link)
 	} else {
-		r0 = ret.Get(0).(bool)
+		r0 = ret.Error(0)
 	}
 
 	return r0
 }
 
-// GetByShortURL provides a mock function with given fields: shortUrl
-func (_m *Store) GetByShortURL(shortUrl string) string {
-	ret := _m.Called(shortUrl)
+// GetByShortURL provides a mock function with given fields: ctx, shortURL
+func (_m *Store) GetByShortURL(ctx context.Context, shortURL string) (*models.UrlCollection, error) {
+	ret := _m.Called(ctx, shortURL)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetByShortURL")
 	}
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(shortUrl)
+	var r0 *models.UrlCollection
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.UrlCollection, error)); ok {
+		return rf(ctx, shortURL)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.UrlCollection); ok {
+		r0 = rf(ctx, shortURL)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.UrlCollection)
+		}
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, shortURL)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// GetByURL provides a mock function with given fields: url
-func (_m *Store) GetByURL(url string) string {
-	ret := _m.Called(url)
+// GetByURL provides a mock function with given fields: ctx, url
+func (_m *Store) GetByURL(ctx context.Context, url string) (*models.UrlCollection, error) {
+	ret := _m.Called(ctx, url)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetByURL")
 	}
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(url)
+	var r0 *models.UrlCollection
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*models.UrlCollection, error)); ok {
+		return rf(ctx, url)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.UrlCollection); ok {
+		r0 = rf(ctx, url)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.UrlCollection)
+		}
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// GetTopThreeDomains provides a mock function with given fields:
-func (_m *Store) GetTopThreeDomains() []models.DomainMetricsCollection {
-	ret := _m.Called()
+// GetClickStats provides a mock function with given fields: ctx, query
+func (_m *Store) GetClickStats(ctx context.Context, query *models.ClickQuery) (*models.ClickStats, error) {
+	ret := _m.Called(ctx, query)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetTopThreeDomains")
+		panic("no return value specified for GetClickStats")
+	}
+
+	var r0 *models.ClickStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ClickQuery) (*models.ClickStats, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ClickQuery) *models.ClickStats); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ClickStats)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *models.ClickQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTopDomains provides a mock function with given fields: ctx, query
+func (_m *Store) GetTopDomains(ctx context.Context, query *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error) {
+	ret := _m.Called(ctx, query)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTopDomains")
 	}
 
 	var r0 []models.DomainMetricsCollection
-	if rf, ok := ret.Get(0).(func() []models.DomainMetricsCollection); ok {
-		r0 = rf()
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.DomainMetricsQuery) ([]models.DomainMetricsCollection, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.DomainMetricsQuery) []models.DomainMetricsCollection); ok {
+		r0 = rf(ctx, query)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.DomainMetricsCollection)
 		}
 	}
 
+	if rf, ok := ret.Get(1).(func(context.Context, *models.DomainMetricsQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *Store) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordClick provides a mock function with given fields: ctx, click
+func (_m *Store) RecordClick(ctx context.Context, click *models.ClickCollection) error {
+	ret := _m.Called(ctx, click)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordClick")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ClickCollection) error); ok {
+		r0 = rf(ctx, click)
+	} else {
+		r0 = ret.Error(0)
+	}
+
 	return r0
 }
 
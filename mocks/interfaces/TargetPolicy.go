@@ -0,0 +1,48 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	url "net/url"
+)
+
+// TargetPolicy is an autogenerated mock type for the TargetPolicy type
+type TargetPolicy struct {
+	mock.Mock
+}
+
+// Check provides a mock function with given fields: ctx, target
+func (_m *TargetPolicy) Check(ctx context.Context, target *url.URL) error {
+	ret := _m.Called(ctx, target)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Check")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *url.URL) error); ok {
+		r0 = rf(ctx, target)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewTargetPolicy creates a new instance of TargetPolicy. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewTargetPolicy(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *TargetPolicy {
+	mock := &TargetPolicy{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
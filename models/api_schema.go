@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// CreateLinkRequest is the JSON body accepted by the link creation endpoint
+type CreateLinkRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt and ExpiresIn are mutually exclusive, ExpiresIn is a duration such as "72h"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn string     `json:"expires_in,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+// ClickQuery selects the clicks of a short url counted in buckets of Interval,
+// starting at Since until the excluded Until
+type ClickQuery struct {
+	ShortURL string
+	Since    time.Time
+	Until    time.Time
+	Interval time.Duration
+}
+
+// ClickStats is the JSON response of the click analytics endpoint. Total counts
+// every click of the short url, the buckets only those of the queried window.
+type ClickStats struct {
+	ShortURL string        `json:"short_url"`
+	Total    int           `json:"total"`
+	Since    time.Time     `json:"since"`
+	Until    time.Time     `json:"until"`
+	Interval string        `json:"interval"`
+	Buckets  []ClickBucket `json:"buckets"`
+}
+
+type ClickBucket struct {
+	Start time.Time `json:"start" bson:"_id"`
+	Count int       `json:"count" bson:"count"`
+}
+
+// DomainMetricsQuery selects a page of the domains with the most shortened urls.
+// Without Since and Until every url ever shortened is counted, otherwise only
+// the urls created in the window which have not been removed since.
+type DomainMetricsQuery struct {
+	Limit  int
+	Offset int
+	Since  time.Time
+	Until  time.Time
+}
+
+// Windowed reports whether the query is limited to a time window
+func (q *DomainMetricsQuery) Windowed() bool {
+	return !q.Since.IsZero() || !q.Until.IsZero()
+}
+
+// Readiness is the JSON response of /readyz, Checks holds the status of the
+// server and of every dependency by name
+type Readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
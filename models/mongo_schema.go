@@ -1,12 +1,39 @@
 package models
 
+import "time"
+
 type UrlCollection struct {
-	URL      string `json:"url" bson:"url"`
-	ShortURL string `json:"short_url" bson:"short_url"`
-	Domain   string `json:"domain" bson:"domain"`
+	URL         string     `json:"url" bson:"url"`
+	OriginalURL string     `json:"original_url,omitempty" bson:"original_url,omitempty"`
+	ShortURL    string     `json:"short_url" bson:"short_url"`
+	Domain      string     `json:"domain" bson:"domain"`
+	Tags        []string   `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// Target returns the url the short url redirects to. URL is the canonical form
+// of the url, OriginalURL is only set when the url was given in another form.
+func (u *UrlCollection) Target() string {
+	if u.OriginalURL != "" {
+		return u.OriginalURL
+	}
+	return u.URL
+}
+
+// Expired reports whether the link has an expiry which has passed at now
+func (u *UrlCollection) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
 
 type DomainMetricsCollection struct {
 	Domain  string `json:"domain" bson:"domain"`
 	Counter int    `json:"counter" bson:"counter"`
 }
+
+type ClickCollection struct {
+	ShortURL  string    `json:"short_url" bson:"short_url"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	Referrer  string    `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+}
@@ -0,0 +1,91 @@
+package monitoring
+
+import (
+	"bufio"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	upper   []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe adds an observation to the histogram
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.buckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Sum returns the sum of the observations
+func (h *Histogram) Sum() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sum
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*family[Histogram]
+	upper []float64
+}
+
+// NewHistogramVec registers a histogram partitioned by the given labels. The
+// buckets are the sorted upper bounds, the +Inf bucket is added implicitly.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	v := &HistogramVec{upper: upper}
+	v.family = newFamily(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{upper: upper, buckets: make([]uint64, len(upper))}
+	})
+	r.register(v)
+	return v
+}
+
+// WithLabelValues returns the histogram of the label values, given in the
+// order the labels were declared
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, h *Histogram) {
+		h.mu.Lock()
+		buckets := append([]uint64(nil), h.buckets...)
+		count, sum := h.count, h.sum
+		h.mu.Unlock()
+
+		prefix := labels
+		if prefix != "" {
+			prefix += ","
+		}
+		var cumulative uint64
+		for i, upper := range v.upper {
+			cumulative += buckets[i]
+			sample(w, v.name+"_bucket", prefix+`le="`+formatFloat(upper)+`"`, float64(cumulative))
+		}
+		sample(w, v.name+"_bucket", prefix+`le="`+formatFloat(math.Inf(1))+`"`, float64(count))
+		sample(w, v.name+"_sum", labels, sum)
+		sample(w, v.name+"_count", labels, float64(count))
+	})
+}
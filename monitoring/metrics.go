@@ -0,0 +1,66 @@
+package monitoring
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRegistry holds the operational metrics of the service
+var DefaultRegistry = NewRegistry()
+
+var (
+	// HTTPRequests counts the handled requests by handler and status code
+	HTTPRequests = DefaultRegistry.NewCounterVec("url_shortener_http_requests_total",
+		"HTTP requests handled, by handler and status code.", "handler", "code")
+	// HTTPRequestDuration observes the time taken by every handler
+	HTTPRequestDuration = DefaultRegistry.NewHistogramVec("url_shortener_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by handler.", DefBuckets, "handler")
+	// Redirects counts the redirects by result: hit, miss, expired, blocked or error
+	Redirects = DefaultRegistry.NewCounterVec("url_shortener_redirects_total",
+		"Redirect requests, by result: hit, miss, expired, blocked or error.", "result")
+	// TargetsRejected counts the urls rejected by the target policies by
+	// operation: create or redirect
+	TargetsRejected = DefaultRegistry.NewCounterVec("url_shortener_targets_rejected_total",
+		"Urls rejected by the target policies, by operation: create or redirect.", "operation")
+	// LinksCreated counts the links stored, existing links returned again are not counted
+	LinksCreated = DefaultRegistry.NewCounter("url_shortener_links_created_total",
+		"Short links created.")
+	// StoreOperationDuration observes the time taken by every store operation
+	StoreOperationDuration = DefaultRegistry.NewHistogramVec("url_shortener_store_operation_duration_seconds",
+		"Time taken by store operations, by backend and operation.", DefBuckets, "backend", "operation")
+	// StoreOperationErrors counts the store operations which failed
+	StoreOperationErrors = DefaultRegistry.NewCounterVec("url_shortener_store_operation_errors_total",
+		"Store operations which returned an error, by backend and operation.", "backend", "operation")
+	// CacheLookups counts the lookups of the link cache by operation and
+	// result: hit, negative_hit or miss
+	CacheLookups = DefaultRegistry.NewCounterVec("url_shortener_cache_lookups_total",
+		"Link cache lookups, by operation and result: hit, negative_hit or miss.", "operation", "result")
+	// CacheEvictions counts the links evicted from the full cache
+	CacheEvictions = DefaultRegistry.NewCounter("url_shortener_cache_evictions_total",
+		"Links evicted from the link cache because it was full.")
+)
+
+// statusRecorder keeps the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// InstrumentHandler counts the requests and observes the latency of the handler
+// under the given name
+func InstrumentHandler(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		HTTPRequestDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		HTTPRequests.WithLabelValues(name, strconv.Itoa(rec.status)).Inc()
+	}
+}
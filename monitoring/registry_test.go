@@ -0,0 +1,88 @@
+package monitoring
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by handler.", "handler", "code")
+	created := r.NewCounter("created_total", "Created links.")
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.5, 0.1}, "handler")
+
+	requests.WithLabelValues("short", "201").Inc()
+	requests.WithLabelValues("short", "201").Add(2)
+	requests.WithLabelValues("redirect", "301").Inc()
+	requests.WithLabelValues("redirect", "301").Add(-1)
+	created.Inc()
+	latency.WithLabelValues("short").Observe(0.05)
+	latency.WithLabelValues("short").Observe(0.1)
+	latency.WithLabelValues("short").Observe(2)
+
+	var buf bytes.Buffer
+	assert.Nil(t, r.Write(&buf))
+	assert.Equal(t, `# HELP requests_total Requests by handler.
+# TYPE requests_total counter
+requests_total{handler="redirect",code="301"} 1
+requests_total{handler="short",code="201"} 3
+# HELP created_total Created links.
+# TYPE created_total counter
+created_total 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{handler="short",le="0.1"} 2
+latency_seconds_bucket{handler="short",le="0.5"} 2
+latency_seconds_bucket{handler="short",le="+Inf"} 3
+latency_seconds_sum{handler="short"} 2.15
+latency_seconds_count{handler="short"} 3
+`, buf.String())
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("escaped_total", "Help with \\ and\nnewline.", "value").WithLabelValues("a\"b\\c\nd").Inc()
+
+	var buf bytes.Buffer
+	assert.Nil(t, r.Write(&buf))
+	assert.Equal(t, `# HELP escaped_total Help with \\ and\nnewline.
+# TYPE escaped_total counter
+escaped_total{value="a\"b\\c\nd"} 1
+`, buf.String())
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests.", "handler")
+	assert.Panics(t, func() { requests.WithLabelValues("short", "201") })
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("created_total", "Created links.")
+
+	w := httptest.NewRecorder()
+	r.Handler()(w, httptest.NewRequest(http.MethodGet, "/prometheus", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "created_total 0\n")
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler("test", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	})
+	before := HTTPRequests.WithLabelValues("test", "404").Value()
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, before+1, HTTPRequests.WithLabelValues("test", "404").Value())
+	assert.Equal(t, uint64(1), HTTPRequestDuration.WithLabelValues("test").Count())
+}
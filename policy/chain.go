@@ -0,0 +1,38 @@
+package policy
+
+import (
+	"context"
+	"net/url"
+	"url-shortener/interfaces"
+)
+
+// chain checks the url with every policy in order
+type chain []interfaces.TargetPolicy
+
+// Chain returns a policy rejecting the urls rejected by any of the policies,
+// which are checked in order. Nil policies are skipped, and nil is returned
+// when there is no policy left.
+func Chain(policies ...interfaces.TargetPolicy) interfaces.TargetPolicy {
+	var c chain
+	for _, p := range policies {
+		if p != nil {
+			c = append(c, p)
+		}
+	}
+	switch len(c) {
+	case 0:
+		return nil
+	case 1:
+		return c[0]
+	}
+	return c
+}
+
+func (c chain) Check(ctx context.Context, target *url.URL) error {
+	for _, p := range c {
+		if err := p.Check(ctx, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
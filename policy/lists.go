@@ -0,0 +1,223 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/interfaces"
+
+	"golang.org/x/net/idna"
+)
+
+// ListsOptions selects the files of the lists. Every line of a file is a
+// rule, empty lines and lines starting with # are skipped. A rule with :// is
+// a pattern matching the whole url, in which * matches any characters, e.g.
+// https://docs.example.com/shared/*. Any other rule is a domain matching the
+// host and its subdomains, e.g. example.com.
+type ListsOptions struct {
+	// DenyFile lists the blocked targets, the lists allow every url without it
+	DenyFile string
+	// AllowFile lists the only targets which are allowed, the lists allow
+	// every url which is not denied without it
+	AllowFile string
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration
+}
+
+// Lists rejects the urls matching the deny list, and the ones not matching
+// the allow list when there is one. The files are read again once they change,
+// a file which cannot be read keeps the rules loaded last.
+type Lists struct {
+	deny  *listFile
+	allow *listFile
+}
+
+// listFile is a list with the rules read from its file
+type listFile struct {
+	name string
+	path string
+
+	mu      sync.RWMutex
+	rules   *rules
+	modTime time.Time
+	size    int64
+}
+
+// rules are the rules of a list
+type rules struct {
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+	// entries keeps the patterns as written for the messages
+	entries []string
+}
+
+// NewLists reads the files and checks them for changes every interval until
+// ctx is done
+func NewLists(ctx context.Context, opts ListsOptions) (interfaces.TargetPolicy, error) {
+	l := &Lists{}
+	if opts.DenyFile != "" {
+		l.deny = &listFile{name: "denylist", path: opts.DenyFile}
+	}
+	if opts.AllowFile != "" {
+		l.allow = &listFile{name: "allowlist", path: opts.AllowFile}
+	}
+	for _, f := range l.files() {
+		if _, err := f.reload(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReloadInterval > 0 {
+		go l.watch(ctx, opts.ReloadInterval)
+	}
+	return l, nil
+}
+
+func (l *Lists) files() []*listFile {
+	var files []*listFile
+	for _, f := range []*listFile{l.deny, l.allow} {
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// watch reloads the files which changed every interval
+func (l *Lists) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range l.files() {
+				if _, err := f.reload(); err != nil {
+					log.Printf("Failed to reload the %v, keeping the previous rules. %v", f.name, err)
+				}
+			}
+		}
+	}
+}
+
+// Check rejects the url with interfaces.ErrBlocked when it is on the deny
+// list, or with interfaces.ErrForbidden when it is not on the allow list
+func (l *Lists) Check(ctx context.Context, target *url.URL) error {
+	host := normalizeHost(target.Hostname())
+	rawURL := target.String()
+	if l.deny != nil {
+		if entry, ok := l.deny.current().match(host, rawURL); ok {
+			return fmt.Errorf("%w: %v matches %q", interfaces.ErrBlocked, rawURL, entry)
+		}
+	}
+	if l.allow != nil {
+		if _, ok := l.allow.current().match(host, rawURL); !ok {
+			return fmt.Errorf("%w: %v is not on the allowlist", interfaces.ErrForbidden, rawURL)
+		}
+	}
+	return nil
+}
+
+func (f *listFile) current() *rules {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rules
+}
+
+// reload reads the file again when it changed since it was read last, and
+// reports whether it did
+func (f *listFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the %v: %w", f.name, err)
+	}
+	f.mu.RLock()
+	unchanged := f.rules != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	rules, err := readRules(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the %v: %w", f.name, err)
+	}
+	f.mu.Lock()
+	f.rules, f.modTime, f.size = rules, info.ModTime(), info.Size()
+	f.mu.Unlock()
+	log.Printf("Loaded %d rules of the %v %v", len(rules.domains)+len(rules.patterns), f.name, f.path)
+	return true, nil
+}
+
+// readRules parses the rules of the file
+func readRules(path string) (*rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := &rules{domains: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("%v:%d: rule %q contains a space", path, n, line)
+		}
+		if strings.Contains(line, "://") {
+			pattern := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(line), `\*`, ".*") + "$"
+			r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+			r.entries = append(r.entries, line)
+			continue
+		}
+		domain := normalizeHost(strings.TrimPrefix(strings.TrimPrefix(line, "*"), "."))
+		if domain == "" || strings.ContainsAny(domain, "/*?#@:") {
+			return nil, fmt.Errorf("%v:%d: %q is neither a domain nor a url pattern", path, n, line)
+		}
+		r.domains[domain] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// match returns the rule matching the host or the url
+func (r *rules) match(host, rawURL string) (string, bool) {
+	for domain := host; domain != ""; {
+		if r.domains[domain] {
+			return domain, true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	for i, pattern := range r.patterns {
+		if pattern.MatchString(rawURL) {
+			return r.entries[i], true
+		}
+	}
+	return "", false
+}
+
+// normalizeHost lowercases the host and converts internationalized names to
+// punycode, so that both forms match the same rule
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeList writes the rules to a file in the directory of the test
+func writeList(t *testing.T, name, rules string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatalf("failed to write %v: %v", path, err)
+	}
+	return path
+}
+
+func TestLists_Deny(t *testing.T) {
+	path := writeList(t, "denylist.txt", `
+# Phishing
+evil.example
+*.Phishing.Example.
+bücher.example
+https://docs.example.com/shared/*
+`)
+	p, err := NewLists(context.Background(), ListsOptions{DenyFile: path})
+	assert.Nil(t, err)
+
+	for _, rawURL := range []string{
+		"https://evil.example/",
+		"https://login.EVIL.example./account",
+		"http://phishing.example/",
+		"https://a.b.phishing.example/",
+		"https://xn--bcher-kva.example/",
+		"https://docs.example.com/shared/abc",
+		"HTTPS://DOCS.example.com/SHARED/abc",
+	} {
+		t.Run("Blocked "+rawURL, func(t *testing.T) {
+			err := check(p, rawURL)
+			assert.ErrorIs(t, err, interfaces.ErrBlocked)
+			assert.ErrorIs(t, err, interfaces.ErrForbidden)
+		})
+	}
+	for _, rawURL := range []string{
+		"https://example/",
+		"https://notevil.example/",
+		"https://evil.example.com/",
+		"https://docs.example.com/private/abc",
+		"https://www.google.com/?q=evil.example",
+	} {
+		t.Run("Allowed "+rawURL, func(t *testing.T) {
+			assert.Nil(t, check(p, rawURL))
+		})
+	}
+}
+
+func TestLists_Allow(t *testing.T) {
+	p, err := NewLists(context.Background(), ListsOptions{
+		DenyFile:  writeList(t, "denylist.txt", "old.example.com\n"),
+		AllowFile: writeList(t, "allowlist.txt", "example.com\nhttps://partner.example/campaigns/*\n"),
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, check(p, "https://example.com/"))
+	assert.Nil(t, check(p, "https://www.example.com/a"))
+	assert.Nil(t, check(p, "https://partner.example/campaigns/2026"))
+	assert.ErrorIs(t, check(p, "https://old.example.com/"), interfaces.ErrBlocked)
+
+	err = check(p, "https://partner.example/other")
+	assert.ErrorIs(t, err, interfaces.ErrForbidden)
+	assert.NotErrorIs(t, err, interfaces.ErrBlocked)
+	assert.ErrorIs(t, check(p, "https://www.google.com/"), interfaces.ErrForbidden)
+}
+
+func TestLists_Reload(t *testing.T) {
+	path := writeList(t, "denylist.txt", "evil.example\n")
+	p, err := NewLists(context.Background(), ListsOptions{DenyFile: path})
+	assert.Nil(t, err)
+	lists := p.(*Lists)
+
+	reloaded, err := lists.deny.reload()
+	assert.Nil(t, err)
+	assert.False(t, reloaded)
+
+	assert.Nil(t, os.WriteFile(path, []byte("evil.example\nnew.example\n"), 0o600))
+	reloaded, err = lists.deny.reload()
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.ErrorIs(t, check(p, "https://new.example/"), interfaces.ErrBlocked)
+
+	// An invalid file keeps the rules loaded last
+	assert.Nil(t, os.WriteFile(path, []byte("bad rule\n"), 0o600))
+	_, err = lists.deny.reload()
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, check(p, "https://new.example/"), interfaces.ErrBlocked)
+
+	assert.Nil(t, os.Remove(path))
+	_, err = lists.deny.reload()
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, check(p, "https://evil.example/"), interfaces.ErrBlocked)
+}
+
+func TestLists_Watch(t *testing.T) {
+	path := writeList(t, "denylist.txt", "evil.example\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewLists(ctx, ListsOptions{DenyFile: path, ReloadInterval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Nil(t, check(p, "https://new.example/"))
+
+	// The time of the change is moved so that it differs from the first write
+	assert.Nil(t, os.WriteFile(path, []byte("new.example\n"), 0o600))
+	assert.Nil(t, os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	assert.Eventually(t, func() bool {
+		return check(p, "https://new.example/") != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, check(p, "https://evil.example/"))
+
+	// The files are not read again once ctx is done
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, os.WriteFile(path, []byte("evil.example\n"), 0o600))
+	assert.Nil(t, os.Chtimes(path, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	assert.Never(t, func() bool {
+		return check(p, "https://evil.example/") != nil
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestNewLists_Errors(t *testing.T) {
+	tests := map[string]string{
+		"Space In Rule":       "evil.example phishing.example\n",
+		"Path Without Scheme": "evil.example/login\n",
+		"Wildcard Only":       "*\n",
+	}
+	for name, rules := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewLists(context.Background(), ListsOptions{DenyFile: writeList(t, "denylist.txt", rules)})
+			assert.NotNil(t, err)
+		})
+	}
+	t.Run("Missing File", func(t *testing.T) {
+		_, err := NewLists(context.Background(), ListsOptions{AllowFile: filepath.Join(t.TempDir(), "missing.txt")})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestChain(t *testing.T) {
+	assert.Nil(t, Chain(nil, nil))
+
+	lists, err := NewLists(context.Background(), ListsOptions{DenyFile: writeList(t, "denylist.txt", "evil.example\n")})
+	assert.Nil(t, err)
+	assert.Equal(t, lists, Chain(nil, lists))
+
+	network := NewNetwork(NetworkOptions{BlockPrivate: true}, hosts(map[string][]string{"intranet": {"10.0.0.1"}}))
+	p := Chain(lists, network)
+	assert.ErrorIs(t, check(p, "https://evil.example/"), interfaces.ErrBlocked)
+	assert.ErrorIs(t, check(p, "http://intranet/"), interfaces.ErrForbidden)
+	assert.ErrorIs(t, check(p, "http://unknown/"), interfaces.ErrInvalidArgument)
+}
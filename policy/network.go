@@ -0,0 +1,190 @@
+// Package policy decides which urls can be shortened.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/interfaces"
+)
+
+// Resolver looks up the addresses of a host, net.DefaultResolver is one
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// NetworkOptions selects the targets rejected by the network policy
+type NetworkOptions struct {
+	// BlockPrivate rejects the loopback, link-local, private (RFC 1918 and
+	// RFC 4193) and unspecified addresses, and localhost
+	BlockPrivate bool
+	// BlockedNetworks are rejected in addition to the private ones
+	BlockedNetworks []netip.Prefix
+	// BlockedHosts are rejected along with their subdomains
+	BlockedHosts []string
+	// ResolveTimeout bounds the lookup of the host, 0 leaves it to the context
+	ResolveTimeout time.Duration
+}
+
+// Network rejects the urls whose host is blocked or resolves to a blocked
+// address. The host is only resolved when the link is created, the policy
+// does not protect against a host which is changed to resolve elsewhere later.
+type Network struct {
+	opts     NetworkOptions
+	resolver Resolver
+}
+
+// NewNetwork returns a network policy resolving the hosts with the resolver
+func NewNetwork(opts NetworkOptions, resolver Resolver) interfaces.TargetPolicy {
+	hosts := make([]string, len(opts.BlockedHosts))
+	for i, host := range opts.BlockedHosts {
+		hosts[i] = strings.TrimSuffix(strings.ToLower(host), ".")
+	}
+	opts.BlockedHosts = hosts
+	return &Network{opts: opts, resolver: resolver}
+}
+
+// ParsePrefixes parses the CIDRs, a single address is read as a network of its own
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Check rejects the url with interfaces.ErrForbidden when its host is blocked.
+// A host which does not exist is an invalid argument, a failed lookup leaves
+// the store unavailable.
+func (n *Network) Check(ctx context.Context, target *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if n.hostBlocked(host) {
+		return fmt.Errorf("%w: host %v is blocked", interfaces.ErrForbidden, host)
+	}
+
+	if addr, ok, err := parseAddr(host); err != nil {
+		return fmt.Errorf("%w: %v", interfaces.ErrInvalidArgument, err)
+	} else if ok {
+		return n.checkAddr(host, addr)
+	}
+
+	if n.opts.ResolveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.opts.ResolveTimeout)
+		defer cancel()
+	}
+	addrs, err := n.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("%w: host %v does not exist", interfaces.ErrInvalidArgument, host)
+		}
+		return fmt.Errorf("%w: failed to resolve %v: %v", interfaces.ErrUnavailable, host, err)
+	}
+	// Every address is checked as the client may connect to any of them
+	for _, addr := range addrs {
+		if err := n.checkAddr(host, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostBlocked reports whether the host or one of its parents is blocked
+func (n *Network) hostBlocked(host string) bool {
+	if n.opts.BlockPrivate && (host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		return true
+	}
+	for _, blocked := range n.opts.BlockedHosts {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddr rejects the address of the host when it is in a blocked network
+func (n *Network) checkAddr(host string, addr netip.Addr) error {
+	addr = addr.Unmap()
+	if n.opts.BlockPrivate && (addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsPrivate() || addr.IsUnspecified()) {
+		return fmt.Errorf("%w: %v resolves to the private address %v", interfaces.ErrForbidden, host, addr)
+	}
+	for _, prefix := range n.opts.BlockedNetworks {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %v resolves to %v in the blocked network %v", interfaces.ErrForbidden, host, addr, prefix)
+		}
+	}
+	return nil
+}
+
+// parseAddr reads the host as an address. Besides the usual forms, browsers
+// read hosts ending in a number as an IPv4 address in the shorthand, octal or
+// hex notation, e.g. 2130706433 or 0x7f.1 for 127.0.0.1, so those are too.
+func parseAddr(host string) (netip.Addr, bool, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true, nil
+	}
+
+	parts := strings.Split(host, ".")
+	if _, err := parseNumber(parts[len(parts)-1]); err != nil {
+		return netip.Addr{}, false, nil
+	}
+	if len(parts) > 4 {
+		return netip.Addr{}, false, fmt.Errorf("host %v is not a valid IPv4 address", host)
+	}
+	var value uint64
+	for i, part := range parts {
+		n, err := parseNumber(part)
+		last := i == len(parts)-1
+		// The last part fills the remaining bytes, the others one byte each
+		limit := uint64(255)
+		if last {
+			limit = 1<<(8*(5-len(parts))) - 1
+		}
+		if err != nil || n > limit {
+			return netip.Addr{}, false, fmt.Errorf("host %v is not a valid IPv4 address", host)
+		}
+		if last {
+			value = value<<(8*(5-len(parts))) | n
+		} else {
+			value = value<<8 | n
+		}
+	}
+	return netip.AddrFrom4([4]byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}), true, nil
+}
+
+// parseNumber parses a decimal, 0x prefixed hex or 0 prefixed octal number
+func parseNumber(s string) (uint64, error) {
+	base := 10
+	switch {
+	case s == "":
+		return 0, errors.New("empty number")
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+		if s == "" {
+			return 0, nil
+		}
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+	return strconv.ParseUint(s, base, 32)
+}
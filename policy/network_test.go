@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+	"url-shortener/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resolverFunc turns a function into a resolver so tests do not need DNS
+type resolverFunc func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+func (f resolverFunc) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return f(ctx, network, host)
+}
+
+// hosts resolves the hosts of the map, other hosts do not exist
+func hosts(addrs map[string][]string) Resolver {
+	return resolverFunc(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		var found []netip.Addr
+		for _, addr := range addrs[host] {
+			found = append(found, netip.MustParseAddr(addr))
+		}
+		if len(found) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return found, nil
+	})
+}
+
+func check(p interfaces.TargetPolicy, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic(err)
+	}
+	return p.Check(context.Background(), u)
+}
+
+func TestNetwork_Check(t *testing.T) {
+	networks, err := ParsePrefixes([]string{"100.64.0.0/10", "203.0.113.7"})
+	assert.Nil(t, err)
+	p := NewNetwork(NetworkOptions{
+		BlockPrivate:    true,
+		BlockedNetworks: networks,
+		BlockedHosts:    []string{"Corp.Example.com."},
+	}, hosts(map[string][]string{
+		"www.google.com":    {"142.250.185.68", "2a00:1450:4001:80b::2004"},
+		"metadata.internal": {"169.254.169.254"},
+		"intranet":          {"10.1.2.3"},
+		"rebind.example":    {"93.184.216.34", "127.0.0.1"},
+		"v6.example":        {"fd12:3456::1"},
+		"mapped.example":    {"::ffff:192.168.0.1"},
+		"cgnat.example":     {"100.64.1.1"},
+		"single.example":    {"203.0.113.7"},
+		"other.example":     {"203.0.113.8"},
+		"example.com.corp":  {"93.184.216.34"},
+	}))
+
+	allowed := []string{
+		"https://www.google.com/search?q=go",
+		"https://WWW.Google.com./",
+		"https://93.184.216.34/",
+		"https://[2a00:1450:4001:80b::2004]/",
+		"https://other.example/",
+		"https://example.com.corp/",
+	}
+	for _, rawURL := range allowed {
+		t.Run("Allowed "+rawURL, func(t *testing.T) {
+			assert.Nil(t, check(p, rawURL))
+		})
+	}
+
+	forbidden := []string{
+		"http://127.0.0.1:8080/admin",
+		"http://localhost/",
+		"http://api.localhost/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://metadata.internal/",
+		"http://10.0.0.1/",
+		"http://172.16.5.4/",
+		"http://192.168.1.1/",
+		"http://0.0.0.0/",
+		"http://[::1]/",
+		"http://[fe80::1%25eth0]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://intranet/wiki",
+		"http://rebind.example/",
+		"http://v6.example/",
+		"http://mapped.example/",
+		"http://cgnat.example/",
+		"http://single.example/",
+		"http://corp.example.com/",
+		"http://wiki.corp.example.com/",
+		"http://2130706433/",
+		"http://0x7f.1/",
+		"http://0177.0.0.1/",
+		"http://10.1/",
+	}
+	for _, rawURL := range forbidden {
+		t.Run("Forbidden "+rawURL, func(t *testing.T) {
+			assert.ErrorIs(t, check(p, rawURL), interfaces.ErrForbidden)
+		})
+	}
+
+	invalid := []string{
+		"http://unknown.example/",
+		"http://256.0.0.1/",
+		"http://1.2.3.4.5/",
+		"http://example.0x/",
+	}
+	for _, rawURL := range invalid {
+		t.Run("Invalid "+rawURL, func(t *testing.T) {
+			err := check(p, rawURL)
+			assert.ErrorIs(t, err, interfaces.ErrInvalidArgument)
+			assert.NotErrorIs(t, err, interfaces.ErrForbidden)
+		})
+	}
+}
+
+func TestNetwork_PrivateAllowed(t *testing.T) {
+	networks, err := ParsePrefixes([]string{"192.0.2.0/24"})
+	assert.Nil(t, err)
+	p := NewNetwork(NetworkOptions{BlockedNetworks: networks}, hosts(map[string][]string{
+		"intranet":  {"10.1.2.3"},
+		"localhost": {"127.0.0.1"},
+	}))
+
+	assert.Nil(t, check(p, "http://intranet/wiki"))
+	assert.Nil(t, check(p, "http://localhost:8080/"))
+	assert.ErrorIs(t, check(p, "http://192.0.2.1/"), interfaces.ErrForbidden)
+}
+
+func TestNetwork_ResolveFailure(t *testing.T) {
+	t.Run("Lookup Error", func(t *testing.T) {
+		p := NewNetwork(NetworkOptions{BlockPrivate: true}, resolverFunc(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+		}))
+		assert.ErrorIs(t, check(p, "https://www.google.com/"), interfaces.ErrUnavailable)
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		p := NewNetwork(NetworkOptions{BlockPrivate: true, ResolveTimeout: 10 * time.Millisecond}, resolverFunc(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+		start := time.Now()
+		assert.ErrorIs(t, check(p, "https://www.google.com/"), interfaces.ErrUnavailable)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+	t.Run("Literal Addresses Are Not Resolved", func(t *testing.T) {
+		p := NewNetwork(NetworkOptions{BlockPrivate: true}, resolverFunc(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			t.Errorf("unexpected lookup of %v", host)
+			return nil, nil
+		}))
+		assert.Nil(t, check(p, "https://93.184.216.34/"))
+	})
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.1.2.3/8", "2001:db8::1", "192.0.2.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}, prefixes)
+
+	for _, cidr := range []string{"10.0.0.0/33", "example.com", ""} {
+		_, err := ParsePrefixes([]string{cidr})
+		assert.NotNil(t, err, cidr)
+	}
+}
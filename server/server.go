@@ -2,40 +2,160 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"url-shortener/config"
 	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/monitoring"
+)
+
+// Status of the readiness checks
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
 )
 
 type Server struct {
-	ctx context.Context
-	a   interfaces.API
+	ctx   context.Context
+	a     interfaces.API
+	store interfaces.Store
+	cfg   config.Server
+	ready atomic.Bool
+}
+
+// Start listens on the configured address and serves the routes until the
+// process is signalled or the context of the server is done
+func (serv *Server) Start() error {
+	ln, err := net.Listen("tcp", serv.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return serv.serve(ln)
+}
+
+// routes returns the handler of every route of the service. The /short/ paths
+// are served before the mux, which would clean the "//" after the scheme of the
+// url in the path and redirect the POST to a GET.
+func (serv *Server) routes() http.Handler {
+	short := monitoring.InstrumentHandler("short", serv.a.UrlShortner)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect/", monitoring.InstrumentHandler("redirect", serv.a.RedirectURL))
+	mux.HandleFunc("/short/", short)
+	mux.HandleFunc("/links", monitoring.InstrumentHandler("links", serv.a.CreateLink))
+	mux.HandleFunc("/metrics/", monitoring.InstrumentHandler("metrics", serv.a.Metrics))
+	mux.HandleFunc("/clicks/", monitoring.InstrumentHandler("clicks", serv.a.ClickStats))
+	mux.HandleFunc("/prometheus", monitoring.DefaultRegistry.Handler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", serv.readyz)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/short/") {
+			short(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// healthz answers as long as the process is able to serve requests
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
 }
 
-// Start handles the routes and starts the server
-func (serv *Server) Start() {
+// readyz pings the store and answers 503 when it is unavailable or once the
+// server is shutting down, so that load balancers stop sending new requests
+// before the connections are drained
+func (serv *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := &models.Readiness{Status: statusOK, Checks: map[string]models.CheckStatus{}}
+
+	server := models.CheckStatus{Status: statusOK}
+	if !serv.ready.Load() {
+		server = models.CheckStatus{Status: statusUnavailable, Error: "shutting down"}
+	}
+	readiness.Checks["server"] = server
+
+	ctx, cancel := context.WithTimeout(r.Context(), serv.cfg.ReadinessTimeout)
+	defer cancel()
+	start := time.Now()
+	store := models.CheckStatus{Status: statusOK}
+	if err := serv.store.Ping(ctx); err != nil {
+		store = models.CheckStatus{Status: statusUnavailable, Error: err.Error()}
+	}
+	store.Duration = time.Since(start).String()
+	readiness.Checks["store"] = store
+
+	status := http.StatusOK
+	for _, check := range readiness.Checks {
+		if check.Status != statusOK {
+			readiness.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(readiness)
+}
+
+// serve handles the routes on the listener. On shutdown it reports not ready
+// for the shutdown delay, then waits for in flight requests to complete until
+// the shutdown timeout.
+func (serv *Server) serve(ln net.Listener) error {
 	ctx, stop := signal.NotifyContext(serv.ctx, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
+	httpServer := &http.Server{
+		Handler:      serv.routes(),
+		ReadTimeout:  serv.cfg.ReadTimeout,
+		WriteTimeout: serv.cfg.WriteTimeout,
+		IdleTimeout:  serv.cfg.IdleTimeout,
+	}
+
+	errs := make(chan error, 1)
 	go func() {
-		http.HandleFunc("/redirect/", serv.a.RedirectURL)
-		http.HandleFunc("/short/", serv.a.UrlShortner)
-		http.HandleFunc("/metrics/", serv.a.Metrics)
-		log.Fatal(http.ListenAndServe(":8080", nil))
+		errs <- httpServer.Serve(ln)
 	}()
+	serv.ready.Store(true)
+	log.Printf("Server listening on %v", ln.Addr())
 
-	<-ctx.Done()
+	select {
+	case err := <-errs:
+		serv.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
 	log.Printf("Server Shutting Down!")
 
-	// Gracefull shutdown
+	// Gracefull shutdown, a second signal is handled by the default handler again
 	stop()
-	return
+	serv.ready.Store(false)
+	time.Sleep(serv.cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serv.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain the connections. %v", err)
+		httpServer.Close()
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 // NewServer returns an entry of the Server struct with values.
-// this is further consumed by the Start function
-func NewServer(ctx context.Context, api interfaces.API) *Server {
-	return &Server{ctx: ctx, a: api}
+// this is further consumed by the Start function, the store is only used
+// for the readiness check
+func NewServer(ctx context.Context, api interfaces.API, store interfaces.Store, cfg config.Server) *Server {
+	return &Server{ctx: ctx, a: api, store: store, cfg: cfg}
 }
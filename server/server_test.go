@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/config"
+	"url-shortener/interfaces"
+	mocks "url-shortener/mocks/interfaces"
+	"url-shortener/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testConfig() config.Server {
+	return config.Server{
+		ReadTimeout:      time.Second,
+		WriteTimeout:     time.Second,
+		IdleTimeout:      time.Second,
+		ShutdownDelay:    50 * time.Millisecond,
+		ShutdownTimeout:  time.Second,
+		ReadinessTimeout: time.Second,
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	testAPI := mocks.NewAPI(t)
+	testStore := mocks.NewStore(t)
+	serv := NewServer(context.Background(), testAPI, testStore, testConfig())
+	testStore.On("Ping", mock.Anything).Return(nil).Once()
+	testAPI.On("Metrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(http.ResponseWriter).WriteHeader(http.StatusCreated)
+	}).Once()
+
+	w := httptest.NewRecorder()
+	serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics/", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestRoutes_ShortPathIsNotCleaned(t *testing.T) {
+	testAPI := mocks.NewAPI(t)
+	serv := NewServer(context.Background(), testAPI, mocks.NewStore(t), testConfig())
+	testAPI.On("UrlShortner", mock.Anything, mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/short/http://intranet/docs"
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(http.ResponseWriter).WriteHeader(http.StatusCreated)
+	}).Once()
+
+	w := httptest.NewRecorder()
+	serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/short/http://intranet/docs", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("Ready", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		serv := NewServer(context.Background(), mocks.NewAPI(t), testStore, testConfig())
+		serv.ready.Store(true)
+		testStore.On("Ping", mock.MatchedBy(func(ctx context.Context) bool {
+			_, ok := ctx.Deadline()
+			return ok
+		})).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		readiness := &models.Readiness{}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(readiness))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", readiness.Status)
+		assert.Equal(t, "ok", readiness.Checks["server"].Status)
+		assert.Equal(t, "ok", readiness.Checks["store"].Status)
+	})
+
+	t.Run("Store Unavailable", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		serv := NewServer(context.Background(), mocks.NewAPI(t), testStore, testConfig())
+		serv.ready.Store(true)
+		testStore.On("Ping", mock.Anything).Return(interfaces.ErrUnavailable).Once()
+
+		w := httptest.NewRecorder()
+		serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		readiness := &models.Readiness{}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(readiness))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "unavailable", readiness.Status)
+		assert.Equal(t, "ok", readiness.Checks["server"].Status)
+		assert.Equal(t, models.CheckStatus{Status: "unavailable", Error: interfaces.ErrUnavailable.Error(), Duration: readiness.Checks["store"].Duration}, readiness.Checks["store"])
+	})
+
+	t.Run("Store Timeout", func(t *testing.T) {
+		testStore := mocks.NewStore(t)
+		cfg := testConfig()
+		cfg.ReadinessTimeout = 20 * time.Millisecond
+		serv := NewServer(context.Background(), mocks.NewAPI(t), testStore, cfg)
+		serv.ready.Store(true)
+		testStore.On("Ping", mock.Anything).Return(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}).Once()
+
+		w := httptest.NewRecorder()
+		serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("Healthz", func(t *testing.T) {
+		serv := NewServer(context.Background(), mocks.NewAPI(t), mocks.NewStore(t), testConfig())
+		w := httptest.NewRecorder()
+		serv.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testAPI := mocks.NewAPI(t)
+	testStore := mocks.NewStore(t)
+	testStore.On("Ping", mock.Anything).Return(nil).Twice()
+	serv := NewServer(ctx, testAPI, testStore, testConfig())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	testAPI.On("RedirectURL", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+		http.Redirect(args.Get(0).(http.ResponseWriter), args.Get(1).(*http.Request), "https://www.google.com", http.StatusMovedPermanently)
+	}).Once()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	base := "http://" + ln.Addr().String()
+	done := make(chan error, 1)
+	go func() {
+		done <- serv.serve(ln)
+	}()
+
+	assert.Eventually(t, serv.ready.Load, time.Second, 10*time.Millisecond)
+	res, err := http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatalf("readyz failed: %v", err)
+	}
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	inFlight := make(chan *http.Response, 1)
+	go func() {
+		res, err := client.Get(base + "/redirect/google.com/7378mDnD")
+		if err != nil {
+			t.Errorf("in flight request failed: %v", err)
+			close(inFlight)
+			return
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		inFlight <- res
+	}()
+	<-started
+
+	cancel()
+	// The server reports not ready during the shutdown delay but still serves
+	assert.Eventually(t, func() bool { return !serv.ready.Load() }, time.Second, time.Millisecond)
+	res, err = http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatalf("readyz failed: %v", err)
+	}
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	close(release)
+	if res := <-inFlight; res != nil {
+		assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	}
+	assert.Nil(t, <-done)
+
+	_, err = http.Get(base + "/readyz")
+	assert.NotNil(t, err)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testAPI := mocks.NewAPI(t)
+	cfg := testConfig()
+	cfg.ShutdownDelay = 0
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	serv := NewServer(ctx, testAPI, mocks.NewStore(t), cfg)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	testAPI.On("Metrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+	}).Once()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- serv.serve(ln)
+	}()
+	go http.Get("http://" + ln.Addr().String() + "/metrics/")
+	<-started
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
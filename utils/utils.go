@@ -1,34 +1,53 @@
 package utils
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
 	"log"
-	"regexp"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
 )
 
-// GetDomain returns the domain name from the url
-func GetDomain(url string) string {
-	if url == "" {
+// GetDomain returns the registrable domain of the url, i.e. its public suffix
+// plus one label, so that www.bbc.co.uk and news.bbc.co.uk are both bbc.co.uk.
+// The url may omit the scheme. Internationalized hosts are returned in their
+// punycode form, so that both spellings of a host give the same domain. Hosts
+// which are IP addresses or public suffixes themselves are returned as is, and
+// urls without a host give an empty domain.
+func GetDomain(rawURL string) string {
+	if rawURL == "" {
 		log.Print("URL Cannot be empty")
 		return ""
 	}
-	m := regexp.MustCompile(`\.?([^.]*.com)`)
-	domain := m.FindStringSubmatch(url)[1]
-
-	return domain
-}
-
-// ShortenURL returns the shortened url with the domain name as the prefix
-func ShortenURL(url string) string {
-	hash := sha1.New()
-	_, err := hash.Write([]byte(url))
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		log.Printf("Unable to write hash. %v", err)
+		log.Printf("Invalid URL %v. %v", rawURL, err)
 		return ""
 	}
-	shortURL := base64.URLEncoding.EncodeToString(hash.Sum(nil))[:8]
 
-	return GetDomain(url) + "/" + shortURL
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if host == "" {
+		log.Printf("URL %v has no host", rawURL)
+		return ""
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	host, err = idna.Lookup.ToASCII(host)
+	if err != nil {
+		log.Printf("Invalid host in %v. %v", rawURL, err)
+		return ""
+	}
 
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// The host is a public suffix, e.g. localhost or github.io
+		return host
+	}
+	return domain
 }